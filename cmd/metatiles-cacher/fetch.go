@@ -1,67 +1,183 @@
 package main
 
 import (
-	"log"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/tierpod/metatiles-cacher/pkg/cache"
 	"github.com/tierpod/metatiles-cacher/pkg/config"
 	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/jobs"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
 	"github.com/tierpod/metatiles-cacher/pkg/util"
 )
 
+// maxFetchItems is the maximum count of tiles or metatiles in one POST request.
+const maxFetchItems = 10000
+
 type fetchHandler struct {
-	logger  *log.Logger
-	cache   cache.ReadWriter
-	cfg     *config.Config
-	fetcher fetch.CacheWriter
+	logger logger.Logger
+	cfg    *config.Store
+	jobs   *jobs.Queue
+}
+
+// fetchResult is the result of adding tile or metatile to the jobs queue.
+type fetchResult struct {
+	Path  string `json:"path"`
+	Job   string `json:"job,omitempty"`
+	State string `json:"state,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// fetchError is the error of adding tile or metatile to the jobs queue with http status.
+type fetchError struct {
+	status int
+	err    error
+}
+
+func (e fetchError) Error() string {
+	return e.err.Error()
 }
 
 func (h fetchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	t, err := tile.NewFromURL(r.URL.Path)
+	if r.Method == http.MethodPost {
+		h.serveBatch(w, r)
+		return
+	}
+
+	l := logger.FromContext(r.Context(), h.logger)
+	j, err := h.enqueue(l, r.URL.Path)
 	if err != nil {
-		h.logger.Printf("[ERROR] wrong request: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		l.Error("Add job failed", "path", r.URL.Path, "error", err)
+		status := err.(fetchError).status
+		if status == http.StatusTooManyRequests {
+			setRetryAfter(w, time.Now().Add(queueFullRetryAfter))
+		}
+		w.WriteHeader(status)
 		return
 	}
 
-	h.logger.Printf("[DEBUG] got request %v", t)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	replyJSON(w, http.StatusAccepted, fetchResult{Path: r.URL.Path, Job: j.ID, State: j.State}, l)
+}
 
-	source, err := h.cfg.Source(t.Map)
+// serveBatch adds tiles or metatiles from request body to the jobs queue. Body is the json array of
+// paths or the list of paths, one per line. If jobs queue is full, the rest of paths are not added
+// and StatusTooManyRequests is returned.
+func (h fetchHandler) serveBatch(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	paths, err := readPaths(r.Body, r.Header.Get("Content-Type"))
 	if err != nil {
-		h.logger.Printf("[ERROR] %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		l.Error("Wrong request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if t.Zoom < source.Zoom.Min || t.Zoom > source.Zoom.Max {
-		h.logger.Printf("[ERROR] wrong zoom level for Source(%v): Zoom(%v)", source.Name, t.Zoom)
-		w.WriteHeader(http.StatusForbidden)
+	if len(paths) > maxFetchItems {
+		http.Error(w, fmt.Sprintf("too many items: %v > %v", len(paths), maxFetchItems), http.StatusRequestEntityTooLarge)
 		return
 	}
 
-	_, err = util.Mimetype(t.Ext)
+	status := http.StatusAccepted
+	result := make([]fetchResult, 0, len(paths))
+	for _, path := range paths {
+		if status == http.StatusTooManyRequests {
+			result = append(result, fetchResult{Path: path, Error: jobs.ErrQueueFull.Error()})
+			continue
+		}
+
+		j, err := h.enqueue(l, path)
+		if err != nil {
+			if err.(fetchError).status == http.StatusTooManyRequests {
+				l.Warn("Add job failed", "path", path, "error", err)
+				status = http.StatusTooManyRequests
+				setRetryAfter(w, time.Now().Add(queueFullRetryAfter))
+			}
+			result = append(result, fetchResult{Path: path, Error: err.Error()})
+			continue
+		}
+		result = append(result, fetchResult{Path: path, Job: j.ID, State: j.State})
+	}
+
+	replyJSON(w, status, result, l)
+}
+
+// enqueue adds job for tile or metatile path to the jobs queue. If metatile is already queued,
+// returns existing job.
+func (h fetchHandler) enqueue(l logger.Logger, path string) (jobs.Job, error) {
+	var mt metatile.Metatile
+	if strings.HasSuffix(path, metatile.Ext) {
+		var err error
+		mt, err = metatile.NewFromURL(path)
+		if err != nil {
+			return jobs.Job{}, fetchError{http.StatusBadRequest, fmt.Errorf("wrong request: %v", err)}
+		}
+	} else {
+		t, err := tile.NewFromURL(path)
+		if err != nil {
+			return jobs.Job{}, fetchError{http.StatusBadRequest, fmt.Errorf("wrong request: %v", err)}
+		}
+
+		if _, err = util.Mimetype(t.Ext); err != nil {
+			return jobs.Job{}, fetchError{http.StatusNotFound, err}
+		}
+		mt = metatile.NewFromTile(t)
+	}
+
+	l.Debug("Got request", "metatile", mt)
+
+	source, err := h.cfg.Get().Source(mt.Map)
 	if err != nil {
-		h.logger.Printf("[ERROR] %v", err)
-		w.WriteHeader(http.StatusNotFound)
-		return
+		return jobs.Job{}, fetchError{http.StatusNotFound, err}
+	}
+
+	if mt.Zoom < source.Zoom.Min || mt.Zoom > source.Zoom.Max {
+		return jobs.Job{}, fetchError{http.StatusForbidden, fmt.Errorf("wrong zoom level for Source(%v): Zoom(%v)", source.Name, mt.Zoom)}
 	}
 
-	// fetch tiles for metatile and write to cache
-	mt := metatile.NewFromTile(t)
-	err = h.fetcher.MetatileWriteToCache(mt, source.URL, h.cache)
+	j, _, err := h.jobs.Add(jobs.New(mt, source.Name, int(fetch.PriorityFetch)))
+	if err == jobs.ErrQueueFull {
+		return jobs.Job{}, fetchError{http.StatusTooManyRequests, err}
+	}
 	if err != nil {
-		if err == fetch.ErrQueueHasKey {
-			w.WriteHeader(http.StatusCreated)
-			return
-		}
+		return jobs.Job{}, fetchError{http.StatusInternalServerError, err}
+	}
 
-		h.logger.Printf("[ERROR]: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	return j, nil
+}
+
+// readPaths reads json array of strings, if contentType is application/json. Otherwise reads
+// non-empty lines.
+func readPaths(r io.Reader, contentType string) ([]string, error) {
+	var paths []string
+	if strings.HasPrefix(contentType, "application/json") {
+		err := json.NewDecoder(r).Decode(&paths)
+		return paths, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		paths = append(paths, line)
 	}
 
-	return
+	return paths, scanner.Err()
+}
+
+// replyJSON writes v in json format with given status.
+func replyJSON(w http.ResponseWriter, status int, v interface{}, l logger.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		l.Error("replyJSON: encode failed", "error", err)
+	}
 }
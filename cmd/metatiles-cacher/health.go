@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// upstreamProbeTimeout is the timeout of checking remote source in /readyz.
+const upstreamProbeTimeout = 2 * time.Second
+
+// upstreamProbeTTL is the time result of checking remote source is reused for.
+const upstreamProbeTTL = 10 * time.Second
+
+// shutdownState is set when graceful shutdown starts.
+type shutdownState struct {
+	v int32
+}
+
+func (s *shutdownState) set() {
+	atomic.StoreInt32(&s.v, 1)
+}
+
+func (s *shutdownState) isSet() bool {
+	return atomic.LoadInt32(&s.v) == 1
+}
+
+// healthzHandler reports that service is alive: /healthz.
+type healthzHandler struct{}
+
+func (h healthzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// probeCache contains results of checking remote sources by source name, so frequent /readyz
+// requests do not probe upstreams each time.
+type probeCache struct {
+	mx      sync.Mutex
+	results map[string]*probeResult
+}
+
+type probeResult struct {
+	mx      sync.Mutex
+	err     error
+	checked time.Time
+}
+
+func newProbeCache() *probeCache {
+	return &probeCache{results: make(map[string]*probeResult)}
+}
+
+// probe returns result of checking src by fetcher, probing it again if result is older than
+// upstreamProbeTTL. Concurrent calls for the same source wait for one probe.
+func (c *probeCache) probe(fetcher *fetch.Fetch, src config.Source) error {
+	c.mx.Lock()
+	r, found := c.results[src.Name]
+	if !found {
+		r = &probeResult{}
+		c.results[src.Name] = r
+	}
+	c.mx.Unlock()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if time.Since(r.checked) >= upstreamProbeTTL {
+		r.err = fetcher.Probe(src, upstreamProbeTimeout)
+		r.checked = time.Now()
+	}
+
+	return r.err
+}
+
+// readyzHandler reports if service is ready to serve requests: /readyz. Returns StatusOK or
+// StatusServiceUnavailable with the list of checks in json format.
+type readyzHandler struct {
+	logger   logger.Logger
+	cfg      *config.Store
+	fetcher  *fetch.Fetch
+	cache    *cache.FileCache
+	probes   *probeCache
+	shutdown *shutdownState
+}
+
+type readyCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Ready  bool         `json:"ready"`
+	Checks []readyCheck `json:"checks"`
+}
+
+func (h readyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	cfg := h.cfg.Get()
+
+	var checks []readyCheck
+	add := func(name string, err error) {
+		c := readyCheck{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	var err error
+	if len(cfg.Sources) == 0 {
+		err = errors.New("no sources configured")
+	}
+	add("config", err)
+	add("cache", h.cache.CheckWritable())
+
+	if cfg.Service.ReadyUpstreams {
+		errs := make([]error, len(cfg.Sources))
+		var wg sync.WaitGroup
+		for i, src := range cfg.Sources {
+			wg.Add(1)
+			go func(i int, src config.Source) {
+				defer wg.Done()
+				errs[i] = h.probes.probe(h.fetcher, src)
+			}(i, src)
+		}
+		wg.Wait()
+
+		for i, src := range cfg.Sources {
+			add("source "+src.Name, errs[i])
+		}
+	}
+
+	if h.shutdown.isSet() {
+		checks = append(checks, readyCheck{Name: "shutdown", Error: "shutting down"})
+	}
+
+	result := readiness{Ready: true, Checks: checks}
+	for _, c := range checks {
+		if !c.OK {
+			result.Ready = false
+			l.Warn("readyz: check failed", "check", c.Name, "error", c.Error)
+		}
+	}
+
+	status := http.StatusOK
+	if !result.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	replyJSON(w, status, result, l)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/jobs"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// jobsWorker takes jobs from persistent queue and fetches metatiles with job priority.
+type jobsWorker struct {
+	logger  logger.Logger
+	queue   *jobs.Queue
+	cache   cache.Writer
+	cfg     *config.Store
+	fetcher *fetch.Fetch
+}
+
+// run takes jobs until ctx is canceled or queue is closed. Running job is waited for regardless of
+// ctx, job cancelled by fetcher shutdown is queued again. Fetching is logged with job id in "job"
+// field.
+func (jw jobsWorker) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		j, err := jw.queue.Next(ctx)
+		if err == jobs.ErrClosed || err != nil && ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			jw.logger.Error("jobs: take job failed", "error", err)
+			continue
+		}
+
+		l := jw.logger.With("job", j.ID)
+		l.Debug("jobs: run", "key", j.Key)
+		source, err := jw.cfg.Get().Source(j.Source)
+		if err != nil {
+			jw.queue.Finish(j.ID, err)
+			continue
+		}
+
+		// priority is read from log file and may be out of range
+		prio := fetch.Priority(j.Priority)
+		if !prio.Valid() {
+			err = fmt.Errorf("jobs: invalid priority %v", j.Priority)
+			l.Error("jobs: fetch failed", "error", err)
+			jw.queue.Finish(j.ID, err)
+			continue
+		}
+
+		fl, _ := jw.fetcher.Start(logger.NewContext(context.Background(), l), j.Metatile(), source, jw.cache, prio)
+		_, err = fl.Wait(context.Background())
+		if err == fetch.ErrShutdown {
+			l.Info("jobs: fetcher is shut down, requeue", "error", err)
+			jw.queue.Requeue(j.ID)
+			return
+		}
+
+		if err == fetch.ErrQueueFull {
+			l.Warn("jobs: fetch queue is full, retry later", "error", err)
+			jw.queue.Requeue(j.ID)
+			select {
+			case <-time.After(queueFullRetryAfter):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err != nil {
+			l.Error("jobs: fetch failed", "error", err)
+		}
+		jw.queue.Finish(j.ID, err)
+	}
+}
+
+// jobsHandler lists jobs from persistent queue in json format: /jobs. Or shows job by id:
+// /jobs/{id}.
+type jobsHandler struct {
+	logger logger.Logger
+	queue  *jobs.Queue
+}
+
+func (h jobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	id := strings.TrimPrefix(r.URL.Path, "/jobs")
+	id = strings.Trim(id, "/")
+	if id == "" {
+		replyJSON(w, http.StatusOK, h.queue.List(), l)
+		return
+	}
+
+	j, found := h.queue.Get(id)
+	if !found {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	replyJSON(w, http.StatusOK, j, l)
+}
@@ -5,25 +5,37 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	// _ "net/http/pprof"
 
+	"github.com/tierpod/metatiles-cacher/pkg/accesslog"
 	"github.com/tierpod/metatiles-cacher/pkg/cache"
 	"github.com/tierpod/metatiles-cacher/pkg/config"
 	"github.com/tierpod/metatiles-cacher/pkg/fetch"
 	"github.com/tierpod/metatiles-cacher/pkg/handler"
+	"github.com/tierpod/metatiles-cacher/pkg/jobs"
 	"github.com/tierpod/metatiles-cacher/pkg/logger"
-	"github.com/tierpod/metatiles-cacher/pkg/queue"
+	"github.com/tierpod/metatiles-cacher/pkg/metrics"
+	"github.com/tierpod/metatiles-cacher/pkg/seed"
 )
 
 var version string
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		os.Exit(seedCommand(os.Args[2:]))
+	}
+
 	// Command line flags
 	var (
 		flagVersion bool
@@ -39,48 +51,237 @@ func main() {
 		os.Exit(0)
 	}
 
+	started := time.Now()
 	cfg, err := config.Load(flagConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	logger := logger.New(os.Stdout, cfg.Log.Debug, cfg.Log.Datetime)
+	logger := logger.New(os.Stdout, logger.Options{
+		Debug:    cfg.Log.Debug,
+		Datetime: cfg.Log.Datetime,
+		JSON:     cfg.Log.Format == "json",
+	})
+	store := config.NewStore(flagConfig, cfg)
+	if cfg.Service.XToken == "" {
+		logger.Warn("x_token is not set, /status, /jobs, /seed and /config/reload are disabled")
+	}
 
 	fc, err := cache.NewFileCache(cfg.FileCache, logger)
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, "Open cache", err)
 	}
 
 	fetcher := fetch.New(cfg.Fetch, logger)
 
-	uq := queue.NewUniq()
+	jq, err := jobs.Open(cfg.Jobs.File, cfg.Jobs.History, cfg.Jobs.MaxQueued)
+	if err != nil {
+		fatal(logger, "Open jobs queue", err)
+	}
+	logger.Info("Jobs queue opened", "file", cfg.Jobs.File, "jobs", jq.Len())
 
-	http.Handle("/status", handler.LogConnection(
-		handler.XToken(
-			statusHandler{queue: uq}, cfg.Service.XToken, logger,
-		),
-		logger))
-	http.Handle("/static/", handler.LogConnection(
-		http.StripPrefix("/static/", http.FileServer(http.Dir("static"))), logger),
-	)
-	http.Handle("/maps/", handler.LogConnection(
-		mapsHandler{
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Jobs.Workers; i++ {
+		jw := jobsWorker{
 			logger:  logger,
+			queue:   jq,
 			cache:   fc,
-			cfg:     cfg,
+			cfg:     store,
 			fetcher: fetcher,
-		}, logger))
-	http.Handle("/fetch/", handler.LogConnection(
-		fetchHandler{
-			logger:  logger,
-			cache:   fc,
-			cfg:     cfg,
-			fetcher: fetcher,
-		}, logger))
+		}
+		workers.Add(1)
+		go jw.run(workersCtx, &workers)
+	}
 
-	logger.Printf("Starting web server on: %v", cfg.Service.Bind)
-	err = http.ListenAndServe(cfg.Service.Bind, nil)
+	al, err := accesslog.NewLogger(cfg.Log.AccessFile, cfg.Log.AccessFormat)
+	if err != nil {
+		fatal(logger, "Open access log", err)
+	}
+	trusted, err := cfg.Log.TrustedNetworks()
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, "Parse trusted proxies", err)
+	}
+	logRequests := func(h http.Handler) http.Handler {
+		return handler.AccessLog(h, al, trusted)
+	}
+
+	http.Handle("/status", logRequests(
+		handler.XToken(
+			statusHandler{
+				logger:  logger,
+				cfg:     store,
+				fetcher: fetcher,
+				cache:   fc,
+				jobs:    jq,
+				started: started,
+			}, cfg.Service.XToken, logger,
+		)))
+	http.Handle("/static/", logRequests(
+		http.StripPrefix("/static/", http.FileServer(http.Dir("static")))),
+	)
+	tiles := mapsHandler{
+		logger:     logger,
+		cache:      fc,
+		cfg:        store,
+		fetcher:    fetcher,
+		prefetcher: fetcher,
+	}
+	http.Handle("/maps/", logRequests(
+		mapsRouter{
+			tiles:    tiles,
+			tilejson: tileJSONHandler{logger: logger, cfg: store},
+		}))
+	wh := logRequests(wmtsHandler{logger: logger, cfg: store, tiles: tiles})
+	http.Handle("/wmts", wh)
+	http.Handle("/wmts/", wh)
+	http.Handle("/fetch/", logRequests(
+		fetchHandler{
+			logger: logger,
+			cfg:    store,
+			jobs:   jq,
+		}))
+	jh := logRequests(
+		handler.XToken(
+			jobsHandler{logger: logger, queue: jq}, cfg.Service.XToken, logger,
+		))
+	http.Handle("/jobs", jh)
+	http.Handle("/jobs/", jh)
+
+	seeds := seed.NewManager(fetcher, fc, logger, seedHistory)
+	sh := logRequests(
+		handler.XToken(
+			seedHandler{
+				logger:  logger,
+				cfg:     store,
+				manager: seeds,
+			}, cfg.Service.XToken, logger,
+		))
+	http.Handle("/seed", sh)
+	http.Handle("/seed/", sh)
+
+	shutdown := &shutdownState{}
+	http.Handle("/healthz", healthzHandler{})
+	http.Handle("/readyz", readyzHandler{
+		logger:   logger,
+		cfg:      store,
+		fetcher:  fetcher,
+		cache:    fc,
+		probes:   newProbeCache(),
+		shutdown: shutdown,
+	})
+
+	registerQueueMetrics(fetcher)
+	var mh http.Handler = metrics.Handler()
+	if cfg.Service.MetricsToken != "" {
+		mh = handler.BearerToken(mh, cfg.Service.MetricsToken, logger)
+	}
+	http.Handle("/metrics", mh)
+	http.Handle("/config/reload", logRequests(
+		handler.XToken(
+			reloadHandler{logger: logger, store: store}, cfg.Service.XToken, logger,
+		)))
+
+	// each request gets request id, which is returned in X-Request-Id header and logged by handlers,
+	// fetcher and cache
+	srv := &http.Server{Addr: cfg.Service.Bind, Handler: handler.RequestID(http.DefaultServeMux, logger)}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting web server", "bind", cfg.Service.Bind)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+
+	for stop := false; !stop; {
+		select {
+		case err = <-serveErr:
+			fatal(logger, "Web server", err)
+		case s := <-sig:
+			switch s {
+			case syscall.SIGHUP:
+				logger.Info("Received signal, reloading config", "signal", s)
+				reloadConfig(store, logger)
+				continue
+			case syscall.SIGUSR1:
+				logger.Info("Received signal, reopening access log", "signal", s)
+				if err = al.Reopen(); err != nil {
+					logger.Error("Reopen access log", "error", err)
+				}
+				continue
+			}
+			logger.Info("Received signal, shutting down", "signal", s)
+			stop = true
+		}
+	}
+
+	// report not ready, so load balancer stops sending new requests before listener is closed
+	shutdown.set()
+	if delay := store.Get().Service.ShutdownDelay; delay > 0 {
+		logger.Info("Waiting before closing listener", "delay", delay)
+		time.Sleep(time.Duration(delay) * time.Second)
+	}
+
+	timeout := time.Duration(store.Get().Service.ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// stop taking new fetch jobs and seeding, then finish requests and running fetchings
+	stopWorkers()
+	seeds.CancelAll()
+
+	clean := true
+	if err = srv.Shutdown(ctx); err != nil {
+		logger.Error("Shutdown: web server", "error", err)
+		clean = false
+	}
+
+	if err = fetcher.Shutdown(ctx); err != nil {
+		logger.Error("Shutdown: fetcher", "error", err)
+		clean = false
+	}
+
+	if err = wait(ctx, &workers); err != nil {
+		logger.Error("Shutdown: jobs workers", "error", err)
+		clean = false
+	}
+
+	if err = jq.Close(); err != nil {
+		logger.Error("Shutdown: jobs queue", "error", err)
+		clean = false
+	}
+
+	if err = al.Close(); err != nil {
+		logger.Error("Shutdown: access log", "error", err)
+	}
+
+	if !clean {
+		logger.Warn("Shutdown is not clean, unfinished fetch jobs are queued again on start")
+		os.Exit(1)
+	}
+
+	logger.Info("Shutdown complete")
+}
+
+// fatal logs error with msg and exits with status 1.
+func fatal(l logger.Logger, msg string, err error) {
+	l.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// wait waits for wg until ctx is done.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
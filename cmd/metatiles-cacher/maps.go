@@ -1,119 +1,186 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/tierpod/metatiles-cacher/pkg/cache"
 	"github.com/tierpod/metatiles-cacher/pkg/config"
 	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/handler"
 	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
 	"github.com/tierpod/metatiles-cacher/pkg/util"
 )
 
+// queueFullRetryAfter is the time after which client should retry request, if fetching queue is full.
+const queueFullRetryAfter = 5 * time.Second
+
 type mapsHandler struct {
-	logger  *log.Logger
+	logger  logger.Logger
 	cache   cache.ReadWriter
-	cfg     *config.Config
+	cfg     *config.Store
 	fetcher fetch.CacheWaitWriter
+	// prefetcher fetches metatiles around fetched metatile in background.
+	prefetcher fetch.Prefetcher
 }
 
 func (h mapsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := handler.NewStatusWriter(w)
+	w = sw
+	// source and zoom labels of metrics, set for known sources and valid zoom levels only, so
+	// requests can not create unbounded count of series
+	labels := []string{"", ""}
+	defer func(start time.Time) { observeRequest(labels, sw, start) }(time.Now())
+
+	ctx := r.Context()
+	l := logger.FromContext(ctx, h.logger)
 	t, err := tile.NewFromURL(r.URL.Path)
 	if err != nil {
-		h.logger.Printf("[ERROR] wrong request: %v", err)
+		l.Error("Wrong request", "path", r.URL.Path, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Printf("[DEBUG] got request %v", t)
+	l.Debug("Got request", "tile", t)
 
-	source, err := h.cfg.Source(t.Map)
+	cfg := h.cfg.Get()
+	source, err := cfg.Source(t.Map)
 	if err != nil {
-		h.logger.Printf("[ERROR] %v", err)
+		l.Error("Unknown source", "error", err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	labels = []string{source.Name, "invalid"}
+	sw.Source = source.Name
 
-	minZoom := source.Zoom.Min
-	maxZoom := source.Zoom.Max
-	// if t.Zoom > maxZoom && source.HasRegion() { // only if tile max zoom always > region max zoom
-	if source.HasRegion() {
-		ll := latlong.New(t.Zoom, t.X, t.Y)
-		if source.Region.Polygons.Contains(ll) {
-			h.logger.Printf("[DEBUG] Point(%v) inside Region(%v)", t, source.Region.File)
-			minZoom = source.Region.Zoom.Min
-			maxZoom = source.Region.Zoom.Max
-		}
-	}
-
+	minZoom, maxZoom := source.ZoomRange(latlong.New(t.Zoom, t.X, t.Y))
 	if t.Zoom < minZoom || t.Zoom > maxZoom {
-		h.logger.Printf("[ERROR] wrong zoom level for Source(%v): Zoom(%v)", source.Name, t.Zoom)
+		l.Error("Wrong zoom level", "source", source.Name, "zoom", t.Zoom)
 		w.WriteHeader(http.StatusForbidden)
 		return
 	}
+	labels[1] = strconv.Itoa(t.Zoom)
 
 	mimetype, err := util.Mimetype(t.Ext)
 	if err != nil {
-		h.logger.Printf("[ERROR] %v", err)
+		l.Error("Unknown extension", "error", err)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	h.logger.Printf("[DEBUG] try get tile from cache")
-	found, mtime := h.cache.Check(t)
+	l.Debug("Try get tile from cache")
+	found, mtime := h.cache.Check(ctx, t)
+	sw.Cache = observeCache(labels, found, mtime, cfg.Service.MaxAge)
 	if found {
 		etag := `"` + util.DigestString(mtime.String()) + `"`
-		h.replyFromCache(w, t, mimetype, etag, r.Header.Get("If-None-Match"))
+		h.replyFromCache(ctx, w, t, mimetype, etag, r.Header.Get("If-None-Match"), cfg.Service.MaxAge)
 		return
 	}
 
 	// fetch tiles for metatile and write to cache?
 	mt := metatile.NewFromTile(t)
-	err = h.fetcher.MetatileWaitWriteToCache(mt, source.URL, h.cache)
+	err = h.fetcher.MetatileWaitWriteToCache(ctx, mt, source, h.cache)
 	if err != nil {
-		h.logger.Printf("[ERROR]: %v", err)
+		if fetch.IsNotFound(err) {
+			l.Debug("Tile not found", "metatile", mt, "error", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if e, ok := err.(fetch.CircuitOpenError); ok {
+			l.Warn("Source is unavailable", "source", source.Name, "error", err)
+			h.replyUnavailable(w, source, mimetype, e.RetryAt)
+			return
+		}
+
+		if err == fetch.ErrQueueFull {
+			l.Warn("Fetch queue is full", "metatile", mt, "error", err)
+			h.replyUnavailable(w, source, mimetype, time.Now().Add(queueFullRetryAfter))
+			return
+		}
+
+		l.Error("Fetch failed", "metatile", mt, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Printf("[DEBUG] try get tile from cache after writing")
+	if source.Prefetch.Enabled() {
+		// prefetching continues after response, so it gets only request logger
+		go h.prefetcher.Prefetch(logger.NewContext(context.Background(), l), mt, source, h.cache)
+	}
+
+	l.Debug("Try get tile from cache after writing")
 	// try again
-	found, mtime = h.cache.Check(t)
+	found, mtime = h.cache.Check(ctx, t)
 	if found {
 		etag := `"` + util.DigestString(mtime.String()) + `"`
-		h.replyFromCache(w, t, mimetype, etag, r.Header.Get("If-None-Match"))
+		h.replyFromCache(ctx, w, t, mimetype, etag, r.Header.Get("If-None-Match"), cfg.Service.MaxAge)
 		return
 	}
 
-	h.logger.Printf("[ERROR] unable to get tile")
+	l.Error("Unable to get tile", "tile", t)
 	w.WriteHeader(http.StatusNotFound)
 	return
 }
 
-func (h mapsHandler) replyFromCache(w http.ResponseWriter, t tile.Tile, mimetype, etag, ifNoneMatch string) {
+func (h mapsHandler) replyFromCache(ctx context.Context, w http.ResponseWriter, t tile.Tile, mimetype, etag, ifNoneMatch string, maxAge int) {
+	l := logger.FromContext(ctx, h.logger)
 	w.Header().Set("Etag", etag)
-	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%v", h.cfg.Service.MaxAge))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%v", maxAge))
 
 	if ifNoneMatch == etag {
-		h.logger.Printf("[DEBUG] replyFromCache: file not modified: Etag(%v) == If-None-Match(%v)", etag, ifNoneMatch)
+		l.Debug("replyFromCache: file not modified", "etag", etag)
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	data, err := h.cache.Read(t)
+	data, err := h.cache.Read(ctx, t)
 	if err != nil {
-		h.logger.Printf("[ERROR] replyFromCache: %v", err)
+		l.Error("replyFromCache: read failed", "tile", t, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	// empty entry is stored for tile which was not fetched from remote source
+	if len(data) == 0 {
+		l.Debug("replyFromCache: empty entry", "tile", t)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
 	w.Header().Set("Content-Type", mimetype)
 	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
 	w.Write(data)
 	return
 }
+
+// replyUnavailable serves blank tile of source without caching, if it is configured. Otherwise
+// returns StatusServiceUnavailable with Retry-After header.
+func (h mapsHandler) replyUnavailable(w http.ResponseWriter, source config.Source, mimetype string, retryAt time.Time) {
+	if source.Partial.Blank == nil {
+		setRetryAfter(w, retryAt)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", mimetype)
+	w.Header().Set("Content-Length", strconv.Itoa(len(source.Partial.Blank)))
+	w.Write(source.Partial.Blank)
+}
+
+// setRetryAfter sets Retry-After header in seconds until t, at least one second.
+func setRetryAfter(w http.ResponseWriter, t time.Time) {
+	sec := int(math.Ceil(time.Until(t).Seconds()))
+	if sec < 1 {
+		sec = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(sec))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/handler"
+	"github.com/tierpod/metatiles-cacher/pkg/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("metatiles_http_requests_total",
+		"Count of tile requests by response status code.", "source", "zoom", "code")
+	httpDuration = metrics.NewHistogram("metatiles_http_request_duration_seconds",
+		"Duration of tile requests.", metrics.DefaultBuckets, "source", "zoom")
+	httpBytes = metrics.NewCounter("metatiles_http_response_bytes_total",
+		"Size of served tiles in bytes.", "source", "zoom")
+	cacheRequests = metrics.NewCounter("metatiles_cache_requests_total",
+		"Count of tile lookups in cache by result: hit, miss, stale (cached longer than max_age ago).", "source", "zoom", "result")
+)
+
+// observeRequest updates metrics of tile request with labels source and zoom, started at start.
+func observeRequest(labels []string, w *handler.StatusWriter, start time.Time) {
+	httpDuration.Observe(time.Since(start).Seconds(), labels...)
+	httpBytes.Add(float64(w.Bytes), labels...)
+	httpRequests.Inc(append(labels, strconv.Itoa(w.Status))...)
+}
+
+// observeCache updates cache lookup metrics and returns lookup result. Cached tile is stale if it is
+// modified more than maxAge seconds ago.
+func observeCache(labels []string, found bool, mtime time.Time, maxAge int) string {
+	result := "miss"
+	if found {
+		result = "hit"
+		if maxAge > 0 && time.Since(mtime) > time.Duration(maxAge)*time.Second {
+			result = "stale"
+		}
+	}
+	cacheRequests.Inc(append(labels, result)...)
+	return result
+}
+
+// registerQueueMetrics registers gauges of fetching queue of fetcher.
+func registerQueueMetrics(fetcher *fetch.Fetch) {
+	gauge := func(value func(s fetch.QueueStat) int) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			var result []metrics.Sample
+			for _, s := range fetcher.QueueStats() {
+				result = append(result, metrics.Sample{Labels: []string{s.Priority}, Value: float64(value(s))})
+			}
+			return result
+		}
+	}
+
+	metrics.NewGaugeFunc("metatiles_queue_pending", "Count of metatiles waiting in the fetching queue.",
+		gauge(func(s fetch.QueueStat) int { return s.Pending }), "priority")
+	metrics.NewGaugeFunc("metatiles_queue_running", "Count of metatiles fetching now.",
+		gauge(func(s fetch.QueueStat) int { return s.Running }), "priority")
+}
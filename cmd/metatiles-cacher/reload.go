@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// restartOptions contains prefixes of options, which are used only on start. Changes of these options
+// are applied after restart.
+var restartOptions = []string{"service.bind", "service.x_token", "service.metrics_token", "log.", "filecache.", "fetch.", "jobs."}
+
+// configChange is the changed configuration option in json format.
+type configChange struct {
+	Path    string `json:"path"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+	Restart bool   `json:"restart,omitempty"`
+}
+
+// reloadConfig reloads configuration and region files, and logs changed options. If configuration is
+// invalid, current configuration is kept.
+func reloadConfig(store *config.Store, l logger.Logger) ([]configChange, error) {
+	changes, err := store.Reload()
+	if err != nil {
+		l.Error("Reload config failed, keep current configuration", "error", err)
+		return nil, err
+	}
+
+	if len(changes) == 0 {
+		l.Info("Reload config: no changes")
+	}
+
+	result := make([]configChange, 0, len(changes))
+	for _, c := range changes {
+		restart := false
+		for _, prefix := range restartOptions {
+			if strings.HasPrefix(c.Path, prefix) {
+				restart = true
+				break
+			}
+		}
+
+		if restart {
+			l.Warn("Reload config: changed, restart required", "option", c.Path, "old", c.Old, "new", c.New)
+		} else {
+			l.Info("Reload config: changed", "option", c.Path, "old", c.Old, "new", c.New)
+		}
+		result = append(result, configChange{Path: c.Path, Old: c.Old, New: c.New, Restart: restart})
+	}
+
+	return result, nil
+}
+
+// reloadHandler reloads configuration: POST /config/reload. Returns list of changed options in json
+// format.
+type reloadHandler struct {
+	logger logger.Logger
+	store  *config.Store
+}
+
+func (h reloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	l := logger.FromContext(r.Context(), h.logger)
+	changes, err := reloadConfig(h.store, l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	replyJSON(w, http.StatusOK, changes, l)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/flags"
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+	"github.com/tierpod/metatiles-cacher/pkg/seed"
+	"github.com/tierpod/metatiles-cacher/pkg/util"
+)
+
+// seedProgressInterval is the interval between progress messages.
+const seedProgressInterval = 10 * time.Second
+
+// seedCommand pre-populates cache for the area and zoom levels. Returns exit code.
+func seedCommand(args []string) int {
+	var (
+		flagConfig  string
+		flagSource  string
+		flagLat     flags.Float64Pair
+		flagLong    flags.Float64Pair
+		flagRegion  string
+		flagZooms   flags.IntPair
+		flagMaxAge  time.Duration
+		flagWorkers int
+		flagRate    float64
+		flagState   string
+	)
+
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	fs.StringVar(&flagConfig, "config", "./config.yaml", "Path to config file")
+	fs.StringVar(&flagSource, "source", "", "Source `name`")
+	fs.Var(&flagLat, "lat", "Latitude coordinates `range`, separated by '-'")
+	fs.Var(&flagLong, "long", "Longitude coordinates `range`, separated by '-'")
+	fs.StringVar(&flagRegion, "region", "", "Region `file` (yaml or kml), seed metatiles intersecting region instead of -lat and -long range")
+	fs.Var(&flagZooms, "zooms", "Zooms `range`, separated by '-' (default: source zoom levels)")
+	fs.DurationVar(&flagMaxAge, "max-age", 0, "Refetch cached metatiles older than `duration` (default: skip all cached)")
+	fs.IntVar(&flagWorkers, "workers", 2, "Count of metatiles fetching at the same time")
+	fs.Float64Var(&flagRate, "rate", 0, "Maximum metatiles per second (default: no limit)")
+	fs.StringVar(&flagState, "state", "", "Path to state `file` for resuming interrupted seeding")
+	fs.Parse(args)
+
+	cfg, err := config.Load(flagConfig)
+	if err != nil {
+		fmt.Printf("[ERROR] %v\n", err)
+		return 1
+	}
+
+	logger := logger.New(os.Stdout, logger.Options{
+		Debug:    cfg.Log.Debug,
+		Datetime: cfg.Log.Datetime,
+		JSON:     cfg.Log.Format == "json",
+	})
+
+	source, err := cfg.Source(flagSource)
+	if err != nil {
+		logger.Error("seed: unknown source", "error", err)
+		return 1
+	}
+
+	var region polygon.Region
+	if flagRegion != "" {
+		region, err = config.ReadRegion(flagRegion)
+		if err != nil {
+			logger.Error("seed: read region", "error", err)
+			return 1
+		}
+	} else if flagLat.Min == 0 && flagLat.Max == 0 || flagLong.Min == 0 && flagLong.Max == 0 {
+		logger.Error("seed: -lat and -long or -region flags are not set or set zero values")
+		return 1
+	}
+
+	zmin, zmax := source.Zoom.Min, source.Zoom.Max
+	if flagZooms.Min != 0 || flagZooms.Max != 0 {
+		if flagZooms.Min > zmin {
+			zmin = flagZooms.Min
+		}
+		if flagZooms.Max < zmax {
+			zmax = flagZooms.Max
+		}
+	}
+	if zmin > zmax {
+		logger.Error("seed: zooms are out of source zoom levels", "zooms", fmt.Sprintf("%v-%v", flagZooms.Min, flagZooms.Max),
+			"source_zooms", fmt.Sprintf("%v-%v", source.Zoom.Min, source.Zoom.Max))
+		return 1
+	}
+
+	fc, err := cache.NewFileCache(cfg.FileCache, logger)
+	if err != nil {
+		logger.Error("seed: open cache", "error", err)
+		return 1
+	}
+
+	// seeding is the only consumer of the fetcher in this process
+	cfg.Fetch.Workers = flagWorkers
+	cfg.Fetch.Shares.Seed = flagWorkers
+	fetcher := fetch.New(cfg.Fetch, logger)
+
+	s := seed.New(seed.Options{
+		Source:    source,
+		Zooms:     util.MakeIntSlice(zmin, zmax+1),
+		Top:       latlong.LatLong{Lat: flagLat.Max, Long: flagLong.Min},
+		Bottom:    latlong.LatLong{Lat: flagLat.Min, Long: flagLong.Max},
+		Region:    region,
+		MaxAge:    flagMaxAge,
+		Workers:   flagWorkers,
+		Rate:      flagRate,
+		StateFile: flagState,
+	}, fetcher, fc, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		logger.Info("seed: interrupted, saving state")
+		cancel()
+	}()
+
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	logger.Info("seed: start", "source", source.Name, "min_zoom", zmin, "max_zoom", zmax, "metatiles", s.Progress().Total)
+	ticker := time.NewTicker(seedProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logger.Info("seed: progress", "progress", s.Progress())
+		case err = <-done:
+			fetcher.SaveNegative()
+			logger.Info("seed: progress", "progress", s.Progress())
+			if err == context.Canceled {
+				logger.Info("seed: stopped, run with the same -state to resume")
+				return 1
+			}
+			if err != nil {
+				logger.Error("seed: failed", "error", err)
+				return 1
+			}
+			return 0
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+	"github.com/tierpod/metatiles-cacher/pkg/seed"
+	"github.com/tierpod/metatiles-cacher/pkg/util"
+)
+
+const (
+	// defaultSeedWorkers is the default count of metatiles fetching at the same time by one seed job.
+	defaultSeedWorkers = 2
+	// seedHistory is the count of finished seed jobs to keep.
+	seedHistory = 100
+)
+
+// seedRequest is the request for creating seed job. One of BBox, GeoJSON or Region must be set.
+type seedRequest struct {
+	Source  string `json:"source"`
+	MinZoom int    `json:"min_zoom"`
+	MaxZoom int    `json:"max_zoom"`
+	// BBox is [min long, min lat, max long, max lat], as in GeoJSON.
+	BBox    []float64       `json:"bbox"`
+	GeoJSON json.RawMessage `json:"geojson"`
+	// Region uses region file from the source configuration.
+	Region  bool    `json:"region"`
+	MaxAge  string  `json:"max_age"`
+	Workers int     `json:"workers"`
+	Rate    float64 `json:"rate"`
+}
+
+// seedHandler creates seed jobs: POST /seed, lists seed jobs: GET /seed, shows seed job:
+// GET /seed/{id}, and controls seed job: POST /seed/{id}/pause, /seed/{id}/resume,
+// /seed/{id}/cancel.
+type seedHandler struct {
+	logger  logger.Logger
+	cfg     *config.Store
+	manager *seed.Manager
+}
+
+func (h seedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/seed"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			replyJSON(w, http.StatusOK, h.manager.List(), l)
+		case http.MethodPost:
+			h.create(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id := parts[0]
+	if len(parts) == 1 {
+		j, found := h.manager.Get(id)
+		if !found {
+			http.Error(w, seed.ErrNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		replyJSON(w, http.StatusOK, j, l)
+		return
+	}
+
+	if len(parts) != 2 || r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var j seed.Job
+	var err error
+	switch parts[1] {
+	case "pause":
+		j, err = h.manager.Pause(id)
+	case "resume":
+		j, err = h.manager.Resume(id)
+	case "cancel":
+		j, err = h.manager.Cancel(id)
+	default:
+		http.Error(w, fmt.Sprintf("unknown action: %v", parts[1]), http.StatusNotFound)
+		return
+	}
+
+	switch err {
+	case nil:
+		replyJSON(w, http.StatusOK, j, l)
+	case seed.ErrNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusConflict)
+	}
+}
+
+func (h seedHandler) create(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	var req seedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("wrong request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	opts, area, err := h.options(req)
+	if err != nil {
+		l.Error("seed: wrong request", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j := h.manager.Start(opts, area)
+	w.Header().Set("Location", "/seed/"+j.ID)
+	replyJSON(w, http.StatusAccepted, j, l)
+}
+
+// options converts request to seeding options. Returns options and the description of seeding area.
+func (h seedHandler) options(req seedRequest) (seed.Options, string, error) {
+	var opts seed.Options
+	var area string
+
+	cfg := h.cfg.Get()
+	source, err := cfg.Source(req.Source)
+	if err != nil {
+		return opts, area, err
+	}
+
+	// more seed workers than fetch workers of seed priority only wait in the fetch queue
+	maxWorkers := cfg.Fetch.Shares.Seed
+	if req.Workers > maxWorkers {
+		return opts, area, fmt.Errorf("workers %v are more than fetch workers of seed priority %v", req.Workers, maxWorkers)
+	}
+
+	zmin, zmax := source.Zoom.Min, source.Zoom.Max
+	if req.MinZoom > zmin {
+		zmin = req.MinZoom
+	}
+	if req.MaxZoom != 0 && req.MaxZoom < zmax {
+		zmax = req.MaxZoom
+	}
+	if zmin > zmax {
+		return opts, area, fmt.Errorf("zooms %v-%v are out of source zoom levels %v-%v", req.MinZoom, req.MaxZoom, source.Zoom.Min, source.Zoom.Max)
+	}
+
+	opts = seed.Options{
+		Source:  source,
+		Zooms:   util.MakeIntSlice(zmin, zmax+1),
+		Workers: req.Workers,
+		Rate:    req.Rate,
+	}
+
+	if opts.Workers <= 0 {
+		opts.Workers = defaultSeedWorkers
+		if opts.Workers > maxWorkers {
+			opts.Workers = maxWorkers
+		}
+	}
+
+	if req.MaxAge != "" {
+		opts.MaxAge, err = time.ParseDuration(req.MaxAge)
+		if err != nil {
+			return opts, area, fmt.Errorf("wrong max_age: %v", err)
+		}
+	}
+
+	switch {
+	case len(req.BBox) > 0:
+		if len(req.BBox) != 4 {
+			return opts, area, fmt.Errorf("wrong bbox: need [min long, min lat, max long, max lat]")
+		}
+		opts.Top = latlong.LatLong{Lat: req.BBox[3], Long: req.BBox[0]}
+		opts.Bottom = latlong.LatLong{Lat: req.BBox[1], Long: req.BBox[2]}
+		area = fmt.Sprintf("bbox %v", req.BBox)
+	case len(req.GeoJSON) > 0:
+		opts.Region, err = polygon.NewFromGeoJSON(req.GeoJSON)
+		if err != nil {
+			return opts, area, err
+		}
+		area = fmt.Sprintf("geojson, %v polygons", len(opts.Region))
+	case req.Region:
+		if !source.HasRegion() {
+			return opts, area, fmt.Errorf("source %v has no region", source.Name)
+		}
+		opts.Region = source.Region.Polygons
+		area = fmt.Sprintf("region %v", source.Region.File)
+	default:
+		return opts, area, fmt.Errorf("bbox, geojson or region is not set")
+	}
+
+	return opts, area, nil
+}
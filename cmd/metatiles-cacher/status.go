@@ -4,17 +4,156 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+	"time"
 
-	"github.com/tierpod/metatiles-cacher/pkg/queue"
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/jobs"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 )
 
+// statusHandler shows service status in json format: /status, or in text format:
+// /status?format=text.
 type statusHandler struct {
-	queue *queue.Uniq
+	logger  logger.Logger
+	cfg     *config.Store
+	fetcher *fetch.Fetch
+	cache   *cache.FileCache
+	jobs    *jobs.Queue
+	started time.Time
+}
+
+type status struct {
+	Version    string            `json:"version"`
+	Started    time.Time         `json:"started"`
+	Uptime     string            `json:"uptime"`
+	Goroutines int               `json:"goroutines"`
+	Config     configSummary     `json:"config"`
+	Queue      []fetch.QueueStat `json:"queue"`
+	InFlight   []fetch.InFlight  `json:"in_flight"`
+	Jobs       int               `json:"queued_jobs"`
+	Sources    []sourceStatus    `json:"sources"`
+	Cache      cacheStatus       `json:"cache"`
+}
+
+type configSummary struct {
+	Bind        string `json:"bind"`
+	MaxAge      int    `json:"max_age"`
+	Workers     int    `json:"fetch_workers"`
+	QueueDepth  int    `json:"queue_depth"`
+	JobsWorkers int    `json:"jobs_workers"`
+	Sources     int    `json:"sources"`
+}
+
+type sourceStatus struct {
+	Name      string                 `json:"name"`
+	MinZoom   int                    `json:"min_zoom"`
+	MaxZoom   int                    `json:"max_zoom"`
+	Region    string                 `json:"region,omitempty"`
+	Prefetch  bool                   `json:"prefetch"`
+	Breaker   *fetch.BreakerState    `json:"breaker,omitempty"`
+	Upstreams []fetch.UpstreamHealth `json:"upstreams"`
+}
+
+type cacheStatus struct {
+	RootDir string `json:"root_dir"`
+	cache.Stats
 }
 
 func (h statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Goroutines: %v\n", runtime.NumGoroutine())
-	fmt.Fprintf(w, "Queue length: %v\n", h.queue.Len())
-	fmt.Fprintf(w, "Queue items: %v\n", h.queue.Items())
-	return
+	s := h.status()
+	if r.URL.Query().Get("format") == "text" {
+		writeStatus(w, s)
+		return
+	}
+
+	replyJSON(w, http.StatusOK, s, logger.FromContext(r.Context(), h.logger))
+}
+
+func (h statusHandler) status() status {
+	cfg := h.cfg.Get()
+
+	breakers := make(map[string]fetch.BreakerState)
+	for _, b := range h.fetcher.Breakers() {
+		breakers[b.Source] = b
+	}
+
+	var sources []sourceStatus
+	for _, src := range cfg.Sources {
+		ss := sourceStatus{
+			Name:      src.Name,
+			MinZoom:   src.Zoom.Min,
+			MaxZoom:   src.Zoom.Max,
+			Region:    src.Region.File,
+			Prefetch:  src.Prefetch.Enabled(),
+			Upstreams: h.fetcher.SourceUpstreams(src),
+		}
+		if b, found := breakers[src.Name]; found {
+			ss.Breaker = &b
+		}
+		sources = append(sources, ss)
+	}
+
+	return status{
+		Version:    version,
+		Started:    h.started,
+		Uptime:     time.Since(h.started).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Config: configSummary{
+			Bind:        cfg.Service.Bind,
+			MaxAge:      cfg.Service.MaxAge,
+			Workers:     cfg.Fetch.Workers,
+			QueueDepth:  cfg.Fetch.QueueDepth,
+			JobsWorkers: cfg.Jobs.Workers,
+			Sources:     len(cfg.Sources),
+		},
+		Queue:    h.fetcher.QueueStats(),
+		InFlight: h.fetcher.InFlight(),
+		Jobs:     h.jobs.Len(),
+		Sources:  sources,
+		Cache:    cacheStatus{RootDir: h.cache.RootDir(), Stats: h.cache.Stats()},
+	}
+}
+
+// writeStatus writes status in text format.
+func writeStatus(w http.ResponseWriter, s status) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	fmt.Fprintf(w, "Version: %v\n", s.Version)
+	fmt.Fprintf(w, "Uptime: %v (started at %v)\n", s.Uptime, s.Started.Format(time.RFC3339))
+	fmt.Fprintf(w, "Goroutines: %v\n", s.Goroutines)
+	fmt.Fprintf(w, "Config: bind %v, %v sources, %v fetch workers, queue depth %v, %v jobs workers\n",
+		s.Config.Bind, s.Config.Sources, s.Config.Workers, s.Config.QueueDepth, s.Config.JobsWorkers)
+
+	for _, q := range s.Queue {
+		fmt.Fprintf(w, "Fetch queue %v: pending %v, running %v/%v\n", q.Priority, q.Pending, q.Running, q.Share)
+	}
+	fmt.Fprintf(w, "In flight: %v\n", len(s.InFlight))
+	for _, f := range s.InFlight {
+		state := f.State
+		if f.Priority != "" {
+			state += " " + f.Priority
+		}
+		fmt.Fprintf(w, "  %v: %v, age %v, waiters %v\n", f.Key, state, f.Age.Round(time.Millisecond), f.Waiters)
+	}
+	fmt.Fprintf(w, "Queued jobs: %v\n", s.Jobs)
+
+	for _, src := range s.Sources {
+		fmt.Fprintf(w, "Source %v: zoom %v-%v", src.Name, src.MinZoom, src.MaxZoom)
+		if src.Breaker != nil {
+			fmt.Fprintf(w, ", breaker %v (failures: %v)", src.Breaker.State, src.Breaker.Failures)
+		}
+		fmt.Fprintln(w)
+		for _, u := range src.Upstreams {
+			state := "up"
+			if u.Down {
+				state = fmt.Sprintf("down until %v", u.RetryAt.Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "  %v: %v, failures %v, metatiles %v\n", u.URL, state, u.Failures, u.Metatiles)
+		}
+	}
+
+	fmt.Fprintf(w, "Cache %v: hits %v, misses %v, writes %v (%v bytes), write errors %v\n",
+		s.Cache.RootDir, s.Cache.Hits, s.Cache.Misses, s.Cache.Writes, s.Cache.WriteBytes, s.Cache.WriteErrors)
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/tilejson"
+)
+
+// tileJSONHandler serves TileJSON document of the source: /maps/{style}.json.
+type tileJSONHandler struct {
+	logger logger.Logger
+	cfg    *config.Store
+}
+
+func (h tileJSONHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	cfg := h.cfg.Get()
+
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/maps/"), ".json")
+	source, err := cfg.Source(name)
+	if err != nil {
+		l.Error("Unknown source", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	replyJSON(w, http.StatusOK, tilejson.New(source, baseURL(r, cfg.Service.PublicURL)), l)
+}
+
+// isTileJSON returns true if path is the path of TileJSON document: /maps/{style}.json.
+func isTileJSON(path string) bool {
+	name := strings.TrimPrefix(path, "/maps/")
+	return strings.HasSuffix(name, ".json") && !strings.Contains(name, "/")
+}
+
+// mapsRouter serves TileJSON documents with tilejson handler and tiles with tiles handler.
+type mapsRouter struct {
+	tiles    http.Handler
+	tilejson http.Handler
+}
+
+func (m mapsRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isTileJSON(r.URL.Path) {
+		m.tilejson.ServeHTTP(w, r)
+		return
+	}
+
+	m.tiles.ServeHTTP(w, r)
+}
+
+// baseURL returns publicURL, if it is set. Otherwise returns URL of service from request.
+func baseURL(r *http.Request, publicURL string) string {
+	if publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/wmts"
+)
+
+// wmtsHandler serves WMTS service with sources as layers. KVP requests: /wmts?SERVICE=WMTS&REQUEST=...,
+// RESTful requests: /wmts/1.0.0/WMTSCapabilities.xml and
+// /wmts/1.0.0/{layer}/{style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.{ext}.
+//
+// Tiles are served by tiles handler as /maps/{layer}/{z}/{x}/{y}.{ext} requests.
+type wmtsHandler struct {
+	logger logger.Logger
+	cfg    *config.Store
+	tiles  http.Handler
+}
+
+func (h wmtsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l := logger.FromContext(r.Context(), h.logger)
+	cfg := h.cfg.Get()
+
+	var op string
+	var tr wmts.TileRequest
+	var err error
+	if path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/wmts"), "/"); path == "" {
+		op, tr, err = wmts.ParseKVP(r.URL.Query())
+	} else {
+		op, tr, err = wmts.ParseREST(path)
+	}
+	if err != nil {
+		replyException(w, err, l)
+		return
+	}
+
+	if op == wmts.GetCapabilities {
+		c := wmts.NewCapabilities(cfg.Sources, baseURL(r, cfg.Service.PublicURL))
+		data, err := xml.MarshalIndent(c, "", "  ")
+		if err != nil {
+			l.Error("WMTS: encode capabilities failed", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(xml.Header))
+		w.Write(data)
+		return
+	}
+
+	source, err := cfg.Source(tr.Layer)
+	if err != nil {
+		replyException(w, wmts.Exception{Code: wmts.InvalidParameterValue, Locator: "Layer", Text: "unknown layer " + tr.Layer}, l)
+		return
+	}
+
+	t, err := tr.Tile(source)
+	if err != nil {
+		replyException(w, err, l)
+		return
+	}
+
+	l.Debug("WMTS: GetTile", "tile", t)
+	tileReq := r.WithContext(r.Context())
+	u := *r.URL
+	u.Path = "/maps/" + t.Filepath("")
+	u.RawQuery = ""
+	tileReq.URL = &u
+	h.tiles.ServeHTTP(w, tileReq)
+}
+
+// replyException writes WMTS exception report. Status is StatusNotImplemented for not supported
+// operations, StatusBadRequest otherwise.
+func replyException(w http.ResponseWriter, err error, l logger.Logger) {
+	e, ok := err.(wmts.Exception)
+	if !ok {
+		e = wmts.Exception{Code: "NoApplicableCode", Text: err.Error()}
+	}
+	l.Error("WMTS: wrong request", "error", e)
+
+	status := http.StatusBadRequest
+	if e.Code == wmts.OperationNotSupported {
+		status = http.StatusNotImplemented
+	}
+
+	data, _ := xml.Marshal(e)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
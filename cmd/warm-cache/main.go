@@ -0,0 +1,253 @@
+// warm-cache is the small tool for warming metatiles cache with tiles, which users actually view.
+// Parses access logs, ranks metatiles by hits and adds the most viewed metatiles to the
+// metatiles-cacher fetch jobs queue.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/accesslog"
+	"github.com/tierpod/metatiles-cacher/pkg/flags"
+	"github.com/tierpod/metatiles-cacher/pkg/jobs"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// Default flags values.
+const (
+	defaultPrefix = "/maps/"
+	defaultURL    = "http://localhost:8080"
+)
+
+// batchSize is the maximum count of metatiles in one /fetch/ request.
+const batchSize = 10000
+
+// defaultRetryAfter is the time after which metatiles are added again, if jobs queue is full and
+// response does not contain Retry-After header.
+const defaultRetryAfter = 5 * time.Second
+
+var version string
+
+func main() {
+	// Command line flags
+	var (
+		flagPrefix  string
+		flagSources string
+		flagZooms   flags.IntPair
+		flagTop     int
+		flagPercent float64
+		flagURL     string
+		flagDryRun  bool
+		flagVersion bool
+	)
+
+	flag.StringVar(&flagPrefix, "prefix", defaultPrefix, "Path `prefix` of tile requests in access logs")
+	flag.StringVar(&flagSources, "sources", "", "Comma-separated list of source `names` (default: all)")
+	flag.Var(&flagZooms, "zooms", "Zooms `range`, separated by '-' (default: all)")
+	flag.IntVar(&flagTop, "top", 0, "Warm `N` most viewed metatiles (default: all)")
+	flag.Float64Var(&flagPercent, "top-percent", 0, "Warm `X` percent of most viewed metatiles (default: all)")
+	flag.StringVar(&flagURL, "url", defaultURL, "metatiles-cacher `url`")
+	flag.BoolVar(&flagDryRun, "dry-run", false, "Print metatiles with hits instead of adding fetch jobs")
+	flag.BoolVar(&flagVersion, "v", false, "Show version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v [flags] [access.log access.log.1.gz ...]\n\nRead stdin if files are not set.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flagVersion {
+		fmt.Printf("Version: %v\n", version)
+		os.Exit(0)
+	}
+
+	sources := make(map[string]bool)
+	for _, s := range strings.Split(flagSources, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sources[s] = true
+		}
+	}
+
+	filter := func(t tile.Tile) bool {
+		if len(sources) > 0 && !sources[t.Map] {
+			return false
+		}
+		if (flagZooms.Min != 0 || flagZooms.Max != 0) && (t.Zoom < flagZooms.Min || t.Zoom > flagZooms.Max) {
+			return false
+		}
+		return true
+	}
+
+	counter := accesslog.NewCounter()
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, file := range files {
+		if err := count(counter, file, flagPrefix, filter); err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	n := flagTop
+	if flagPercent > 0 {
+		n = int(math.Ceil(float64(counter.Len()) * flagPercent / 100))
+	}
+	top := counter.Top(n)
+
+	fmt.Fprintf(os.Stderr, "[INFO] %v hits, %v unique metatiles, warm %v metatiles\n", counter.Total(), counter.Len(), len(top))
+
+	if flagDryRun {
+		for _, s := range top {
+			fmt.Printf("%v %v\n", s.Hits, s.Metatile.Filepath(""))
+		}
+		return
+	}
+
+	failed := 0
+	for i := 0; i < len(top); i += batchSize {
+		end := i + batchSize
+		if end > len(top) {
+			end = len(top)
+		}
+
+		var paths []string
+		for _, s := range top[i:end] {
+			paths = append(paths, s.Metatile.Filepath(""))
+		}
+
+		failed += add(flagURL, paths)
+		fmt.Fprintf(os.Stderr, "[INFO] processed %v/%v metatiles\n", end, len(top))
+	}
+
+	if failed > 0 {
+		fmt.Printf("[WARN] %v metatiles are not added\n", failed)
+	}
+}
+
+// count reads access log file ("-" is stdin, ".gz" files are decompressed) and adds tile requests
+// with prefix to counter.
+func count(counter *accesslog.Counter, file, prefix string, filter func(t tile.Tile) bool) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+
+		if strings.HasSuffix(file, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return fmt.Errorf("%v: %v", file, err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		path, ok := accesslog.ParseLine(scanner.Text())
+		if !ok || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		t, err := tile.NewFromURL(strings.TrimPrefix(path, prefix))
+		if err != nil {
+			continue
+		}
+
+		if filter(t) {
+			counter.Add(t)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+
+	return nil
+}
+
+// fetchResult is the result of adding metatile to the fetch jobs queue.
+type fetchResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// add adds metatile paths to the fetch jobs queue. If jobs queue is full, paths not added are
+// added again after Retry-After. Returns count of metatiles, which are not added.
+func add(url string, paths []string) int {
+	failed := 0
+	for len(paths) > 0 {
+		result, retryAfter, err := post(url, paths)
+		if err != nil {
+			fmt.Printf("[ERROR] %v\n", err)
+			return failed + len(paths)
+		}
+
+		var full []string
+		for _, r := range result {
+			switch {
+			case r.Error == "":
+			case retryAfter > 0 && r.Error == jobs.ErrQueueFull.Error():
+				full = append(full, r.Path)
+			default:
+				fmt.Printf("[WARN] %v: %v\n", r.Path, r.Error)
+				failed++
+			}
+		}
+
+		if len(full) > 0 {
+			fmt.Fprintf(os.Stderr, "[INFO] jobs queue is full, add %v metatiles again after %v\n", len(full), retryAfter)
+			time.Sleep(retryAfter)
+		}
+		paths = full
+	}
+
+	return failed
+}
+
+// post adds metatile paths to the fetch jobs queue with one request. Returns results for each path
+// and, if jobs queue is full, the time after which request should be retried.
+func post(url string, paths []string) ([]fetchResult, time.Duration, error) {
+	client := http.Client{Timeout: time.Minute}
+	body := strings.NewReader(strings.Join(paths, "\n") + "\n")
+	resp, err := client.Post(strings.TrimSuffix(url, "/")+"/fetch/", "text/plain", body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var retryAfter time.Duration
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+	case http.StatusTooManyRequests:
+		retryAfter = defaultRetryAfter
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			retryAfter = time.Duration(s) * time.Second
+		}
+	default:
+		return nil, 0, fmt.Errorf("%v: response status %v", url, resp.Status)
+	}
+
+	var result []fetchResult
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, err
+	}
+
+	return result, retryAfter, nil
+}
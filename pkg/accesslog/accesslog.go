@@ -0,0 +1,118 @@
+// Package accesslog contains functions for writing and parsing access logs and counting metatiles
+// hits.
+//
+// Supported formats are handler.LogConnection lines:
+//
+//	2017/10/19 03:08:01 10.145.0.45:51234 - "GET /maps/style/16/60504/3936.png"
+//
+// and common or combined log format:
+//
+//	10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png HTTP/1.1" 200 126
+package accesslog
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// ParseLine returns request path from access log line. Returns false, if line does not contain GET
+// request or response status is not successful (2xx or 304). Query string is removed from path.
+func ParseLine(line string) (string, bool) {
+	start := strings.IndexByte(line, '"')
+	if start == -1 {
+		return "", false
+	}
+
+	end := strings.IndexByte(line[start+1:], '"')
+	if end == -1 {
+		return "", false
+	}
+	end += start + 1
+
+	fields := strings.Fields(line[start+1 : end])
+	if len(fields) < 2 || fields[0] != "GET" {
+		return "", false
+	}
+
+	// common and combined log format contain status after request
+	if rest := strings.Fields(line[end+1:]); len(rest) > 0 {
+		status, err := strconv.Atoi(rest[0])
+		if err == nil && !(status >= 200 && status < 300 || status == 304) {
+			return "", false
+		}
+	}
+
+	path := fields[1]
+	if i := strings.IndexByte(path, '?'); i != -1 {
+		path = path[:i]
+	}
+
+	return path, true
+}
+
+// Stat contains count of hits of metatile.
+type Stat struct {
+	Metatile metatile.Metatile
+	Hits     int
+}
+
+// Counter counts hits of metatiles.
+type Counter struct {
+	stats map[string]*Stat
+	total int
+}
+
+// NewCounter creates new Counter.
+func NewCounter() *Counter {
+	return &Counter{stats: make(map[string]*Stat)}
+}
+
+// Add adds hit of metatile, which contains tile t.
+func (c *Counter) Add(t tile.Tile) {
+	mt := metatile.NewFromTile(t)
+	key := mt.Filepath("")
+	s, found := c.stats[key]
+	if !found {
+		s = &Stat{Metatile: mt}
+		c.stats[key] = s
+	}
+
+	s.Hits++
+	c.total++
+}
+
+// Len returns count of unique metatiles.
+func (c *Counter) Len() int {
+	return len(c.stats)
+}
+
+// Total returns count of hits.
+func (c *Counter) Total() int {
+	return c.total
+}
+
+// Top returns n metatiles with the most hits, sorted by hits. If n <= 0 or greater than count of
+// metatiles, returns all metatiles.
+func (c *Counter) Top(n int) []Stat {
+	result := make([]Stat, 0, len(c.stats))
+	for _, s := range c.stats {
+		result = append(result, *s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Hits != result[j].Hits {
+			return result[i].Hits > result[j].Hits
+		}
+		return result[i].Metatile.Filepath("") < result[j].Metatile.Filepath("")
+	})
+
+	if n > 0 && n < len(result) {
+		result = result[:n]
+	}
+
+	return result
+}
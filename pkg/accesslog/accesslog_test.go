@@ -0,0 +1,67 @@
+package accesslog
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+func ExampleParseLine() {
+	lines := []string{
+		`2017/10/19 03:08:01 10.145.0.45:51234 - "GET /maps/style/16/60504/3936.png"`,
+		`10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png?v=2 HTTP/1.1" 200 126`,
+		`10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png HTTP/1.1" 304 0 "-" "Mozilla/5.0"`,
+		`10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png HTTP/1.1" 404 0`,
+		`10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "POST /fetch/ HTTP/1.1" 202 126`,
+		`Starting web server on: :8080`,
+	}
+
+	for _, l := range lines {
+		fmt.Println(ParseLine(l))
+	}
+
+	// Output:
+	// /maps/style/16/60504/3936.png true
+	// /maps/style/16/60504/3936.png true
+	// /maps/style/16/60504/3936.png true
+	//  false
+	//  false
+	//  false
+}
+
+func ExampleCounter_Top() {
+	c := NewCounter()
+	c.Add(tile.Tile{Map: "style", Zoom: 10, X: 696, Y: 320})
+	c.Add(tile.Tile{Map: "style", Zoom: 10, X: 697, Y: 321})
+	c.Add(tile.Tile{Map: "style", Zoom: 10, X: 0, Y: 0})
+
+	fmt.Println(c.Len(), c.Total())
+	for _, s := range c.Top(1) {
+		fmt.Println(s.Metatile.Filepath(""), s.Hits)
+	}
+
+	// Output:
+	// 2 3
+	// style/10/0/0/33/180/128.meta 2
+}
+
+func ExampleEntry_Combined() {
+	e := Entry{
+		RemoteAddr: "10.145.0.45",
+		Time:       time.Date(2017, 10, 19, 3, 8, 1, 0, time.FixedZone("", 5*3600)),
+		Method:     "GET",
+		URI:        "/maps/style/16/60504/3936.png",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+		Bytes:      126,
+		UserAgent:  "Mozilla/5.0",
+	}
+
+	fmt.Println(e.Combined())
+	fmt.Println(ParseLine(e.Combined()))
+
+	// Output:
+	// 10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png HTTP/1.1" 200 126 "-" "Mozilla/5.0"
+	// /maps/style/16/60504/3936.png true
+}
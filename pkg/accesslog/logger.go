@@ -0,0 +1,166 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats.
+const (
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+	FormatJSON     = "json"
+)
+
+// commonTime is the time format of common log format.
+const commonTime = "02/Jan/2006:15:04:05 -0700"
+
+// Entry contains information about served request.
+type Entry struct {
+	RemoteAddr string
+	Time       time.Time
+	Method     string
+	URI        string
+	Proto      string
+	Status     int
+	Bytes      int
+	Referer    string
+	UserAgent  string
+	Latency    time.Duration
+	// Source name and cache lookup result (hit, miss), if they are known.
+	Source string
+	Cache  string
+	// Request id, if it is set.
+	RequestID string
+}
+
+// Common formats entry in common log format:
+//
+//	10.145.0.45 - - [19/Oct/2017:03:08:01 +0500] "GET /maps/style/16/60504/3936.png HTTP/1.1" 200 126
+func (e Entry) Common() string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.Itoa(e.Bytes)
+	}
+
+	return fmt.Sprintf("%v - - [%v] \"%v %v %v\" %v %v", e.RemoteAddr, e.Time.Format(commonTime),
+		e.Method, e.URI, e.Proto, e.Status, bytes)
+}
+
+// Combined formats entry in combined log format: common log format with referer and user agent.
+func (e Entry) Combined() string {
+	return fmt.Sprintf("%v %q %q", e.Common(), orDash(e.Referer), orDash(e.UserAgent))
+}
+
+// MarshalJSON implements json.Marshaler interface. Latency is formatted in seconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RemoteAddr string    `json:"remote_addr"`
+		Time       time.Time `json:"time"`
+		Method     string    `json:"method"`
+		URI        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Status     int       `json:"status"`
+		Bytes      int       `json:"bytes"`
+		Referer    string    `json:"referer,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		Latency    float64   `json:"latency"`
+		Source     string    `json:"source,omitempty"`
+		Cache      string    `json:"cache,omitempty"`
+		RequestID  string    `json:"request_id,omitempty"`
+	}{e.RemoteAddr, e.Time, e.Method, e.URI, e.Proto, e.Status, e.Bytes, e.Referer, e.UserAgent,
+		e.Latency.Seconds(), e.Source, e.Cache, e.RequestID})
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Logger writes access log entries to file or stdout.
+type Logger struct {
+	mx     sync.Mutex
+	path   string
+	format string
+	out    io.Writer
+	file   *os.File
+}
+
+// NewLogger creates new Logger, which writes entries in format to file path. If path is empty,
+// entries are written to stdout.
+func NewLogger(path, format string) (*Logger, error) {
+	switch format {
+	case FormatCommon, FormatCombined, FormatJSON:
+	default:
+		return nil, fmt.Errorf("accesslog: unknown format: %v", format)
+	}
+
+	l := &Logger{path: path, format: format, out: os.Stdout}
+	if err := l.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Reopen reopens log file, e.g. after it is rotated. Does nothing if log is written to stdout.
+func (l *Logger) Reopen() error {
+	if l.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("accesslog: %v", err)
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = f
+	l.out = f
+	return nil
+}
+
+// Close closes log file.
+func (l *Logger) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	l.out = os.Stdout
+	return err
+}
+
+// Log writes entry in logger format.
+func (l *Logger) Log(e Entry) {
+	var line []byte
+	switch l.format {
+	case FormatCommon:
+		line = []byte(e.Common())
+	case FormatJSON:
+		line, _ = json.Marshal(e)
+	default:
+		line = []byte(e.Combined())
+	}
+	line = append(line, '\n')
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.out.Write(line)
+}
@@ -0,0 +1,87 @@
+package bbox
+
+import (
+	"context"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// Metatiles iterates over unique metatiles of the area for each zoom level. Metatiles on zoom
+// level are iterated in Z-order, so neighbour metatiles are close to each other.
+type Metatiles struct {
+	zooms  []int
+	relate func(z int) relateFunc
+	count  int
+}
+
+// NewMetatiles creates iterator over metatiles from top to bottom coordinates.
+func NewMetatiles(zooms []int, top, bottom latlong.LatLong) *Metatiles {
+	return newMetatiles(zooms, func(z int) relateFunc {
+		tTop := tile.NewFromLatLong(top, z)
+		tBottom := tile.NewFromLatLong(bottom, z)
+		return rectRelate(tTop.X, tTop.Y, tBottom.X, tBottom.Y)
+	})
+}
+
+// NewMetatilesFromRegion creates iterator over metatiles, which intersect region.
+func NewMetatilesFromRegion(zooms []int, region polygon.Region) *Metatiles {
+	return newMetatiles(zooms, func(z int) relateFunc {
+		return regionRelate(region, z)
+	})
+}
+
+func newMetatiles(zooms []int, relate func(z int) relateFunc) *Metatiles {
+	m := &Metatiles{zooms: zooms, relate: relate}
+	for _, z := range zooms {
+		m.count += count(z, metatile.MaxSize, relate(z))
+	}
+
+	return m
+}
+
+// Count returns count of metatiles.
+func (m *Metatiles) Count() int {
+	return m.count
+}
+
+// Each calls fn for each metatile. Stops if fn returns false or ctx is done. Returns ctx.Err(),
+// if ctx is done.
+func (m *Metatiles) Each(ctx context.Context, fn func(mt metatile.Metatile) bool) error {
+	for _, z := range m.zooms {
+		zoom := z
+		ok := walk(zoom, metatile.MaxSize, m.relate(zoom), func(x, y int) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			return fn(metatile.NewFromTile(tile.Tile{Zoom: zoom, X: x, Y: y}))
+		})
+		if !ok {
+			break
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Iterate returns output chan with metatiles. Chan is closed after the last metatile or if ctx is
+// done.
+func (m *Metatiles) Iterate(ctx context.Context) <-chan metatile.Metatile {
+	ch := make(chan metatile.Metatile)
+
+	go func() {
+		defer close(ch)
+		m.Each(ctx, func(mt metatile.Metatile) bool {
+			select {
+			case ch <- mt:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	return ch
+}
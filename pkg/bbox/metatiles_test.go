@@ -0,0 +1,84 @@
+package bbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+)
+
+func TestNewMetatiles(t *testing.T) {
+	top := latlong.LatLong{Lat: 55.9, Long: 37.3}
+	bottom := latlong.LatLong{Lat: 55.5, Long: 37.9}
+	zooms := []int{1, 2, 10, 14, 16}
+
+	expected := make(map[string]bool)
+	for t := range NewFromLatLong(zooms, top, bottom, "png") {
+		expected[metatile.NewFromTile(t).Filepath("")] = true
+	}
+
+	m := NewMetatiles(zooms, top, bottom)
+	seen := make(map[string]bool)
+	err := m.Each(context.Background(), func(mt metatile.Metatile) bool {
+		path := mt.Filepath("")
+		if seen[path] {
+			t.Errorf("Each: duplicate metatile %v", path)
+		}
+		seen[path] = true
+		return true
+	})
+
+	if err != nil || m.Count() != len(expected) || len(seen) != len(expected) {
+		t.Errorf("Each: expected %v metatiles, got %v, count %v, error %v", len(expected), len(seen), m.Count(), err)
+	}
+
+	for k := range expected {
+		if !seen[k] {
+			t.Errorf("Each: metatile %v is missing", k)
+		}
+	}
+}
+
+func TestMetatilesZOrder(t *testing.T) {
+	// 4x4 metatiles on zoom 5
+	m := NewMetatiles([]int{5}, latlong.New(5, 0, 0), latlong.New(5, 31, 31))
+
+	var result [][2]int
+	for mt := range m.Iterate(context.Background()) {
+		result = append(result, [2]int{mt.X / metatile.MaxSize, mt.Y / metatile.MaxSize})
+	}
+
+	expected := [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 0}, {3, 0}, {2, 1}, {3, 1}}
+	if len(result) != 16 {
+		t.Fatalf("Iterate: expected 16 metatiles, got %v", len(result))
+	}
+
+	for i, xy := range expected {
+		if result[i] != xy {
+			t.Errorf("Iterate: expected %v at %v, got %v", xy, i, result[i])
+		}
+	}
+}
+
+func TestMetatilesCancel(t *testing.T) {
+	m := NewMetatiles([]int{16}, latlong.LatLong{Lat: 56, Long: 37}, latlong.LatLong{Lat: 55, Long: 38})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := 0
+	for range m.Iterate(ctx) {
+		n++
+		if n == 10 {
+			cancel()
+		}
+	}
+
+	if n >= m.Count() {
+		t.Errorf("Iterate: expected stop after cancel, got %v of %v metatiles", n, m.Count())
+	}
+
+	if err := m.Each(ctx, func(mt metatile.Metatile) bool { return true }); err != context.Canceled {
+		t.Errorf("Each: expected context.Canceled, got %v", err)
+	}
+}
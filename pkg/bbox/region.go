@@ -0,0 +1,112 @@
+package bbox
+
+import (
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// NewFromRegion returns output chan with tiles, which intersect region, for each zoom level in
+// zooms.
+func NewFromRegion(zooms []int, region polygon.Region, ext string) <-chan (tile.Tile) {
+	ch := make(chan tile.Tile)
+
+	go func() {
+		defer close(ch)
+		for _, z := range zooms {
+			zoom := z
+			walk(zoom, 1, regionRelate(region, zoom), func(x, y int) bool {
+				ch <- tile.Tile{Zoom: zoom, X: x, Y: y, Ext: ext}
+				return true
+			})
+		}
+	}()
+
+	return ch
+}
+
+// relateFunc returns relation between area and square of side x side tiles with top-left tile
+// x, y.
+type relateFunc func(x, y, side int) polygon.Relation
+
+func regionRelate(region polygon.Region, z int) relateFunc {
+	return func(x, y, side int) polygon.Relation {
+		return region.Relate(latlong.New(z, x, y), latlong.New(z, x+side, y+side))
+	}
+}
+
+// rectRelate returns relateFunc for rectangle of tiles from x0, y0 to x1, y1 inclusive.
+func rectRelate(x0, y0, x1, y1 int) relateFunc {
+	return func(x, y, side int) polygon.Relation {
+		xe, ye := x+side-1, y+side-1
+		switch {
+		case x > x1 || xe < x0 || y > y1 || ye < y0:
+			return polygon.Outside
+		case x >= x0 && xe <= x1 && y >= y0 && ye <= y1:
+			return polygon.Inside
+		}
+		return polygon.Intersects
+	}
+}
+
+// walk calls fn with top-left tile coordinates of each square of size x size tiles on zoom level
+// z, which intersects area, in Z-order. Squares are walked from the whole world down with skipping
+// squares outside of area, and without checks inside of area. Stops if fn returns false. Returns
+// false if stopped.
+func walk(z, size int, relate relateFunc, fn func(x, y int) bool) bool {
+	n := 1 << uint(z)
+	if size > n {
+		size = n
+	}
+
+	var rec func(x, y, side int, inside bool) bool
+	rec = func(x, y, side int, inside bool) bool {
+		if !inside {
+			switch relate(x, y, side) {
+			case polygon.Outside:
+				return true
+			case polygon.Inside:
+				inside = true
+			}
+		}
+
+		if side == size {
+			return fn(x, y)
+		}
+
+		half := side / 2
+		return rec(x, y, half, inside) &&
+			rec(x+half, y, half, inside) &&
+			rec(x, y+half, half, inside) &&
+			rec(x+half, y+half, half, inside)
+	}
+
+	return rec(0, 0, n, false)
+}
+
+// count returns count of squares, which would be walked by walk with the same arguments.
+func count(z, size int, relate relateFunc) int {
+	n := 1 << uint(z)
+	if size > n {
+		size = n
+	}
+
+	var rec func(x, y, side int) int
+	rec = func(x, y, side int) int {
+		switch relate(x, y, side) {
+		case polygon.Outside:
+			return 0
+		case polygon.Inside:
+			return (side / size) * (side / size)
+		}
+
+		if side == size {
+			return 1
+		}
+
+		half := side / 2
+		return rec(x, y, half) + rec(x+half, y, half) + rec(x, y+half, half) + rec(x+half, y+half, half)
+	}
+
+	return rec(0, 0, n)
+}
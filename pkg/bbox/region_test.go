@@ -0,0 +1,77 @@
+package bbox
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+)
+
+func TestNewFromRegion(t *testing.T) {
+	top := latlong.LatLong{Lat: 55.9, Long: 37.3}
+	bottom := latlong.LatLong{Lat: 55.5, Long: 37.9}
+	rect := polygon.Region{polygon.Polygon{
+		top,
+		latlong.LatLong{Lat: top.Lat, Long: bottom.Long},
+		bottom,
+		latlong.LatLong{Lat: bottom.Lat, Long: top.Long},
+	}}
+	// triangle, half of rectangle
+	triangle := polygon.Region{polygon.Polygon{
+		top,
+		latlong.LatLong{Lat: top.Lat, Long: bottom.Long},
+		bottom,
+	}}
+
+	zooms := []int{1, 10, 14}
+	var all, inRect, inTriangle int
+	for range NewFromLatLong(zooms, top, bottom, "png") {
+		all++
+	}
+	for range NewFromRegion(zooms, rect, "png") {
+		inRect++
+	}
+	for range NewFromRegion(zooms, triangle, "png") {
+		inTriangle++
+	}
+
+	if inRect != all {
+		t.Errorf("NewFromRegion: rectangle: expected %v tiles, got %v", all, inRect)
+	}
+
+	if inTriangle >= inRect || inTriangle <= inRect/2 {
+		t.Errorf("NewFromRegion: triangle: expected a bit more than half of %v tiles, got %v", inRect, inTriangle)
+	}
+}
+
+func TestNewMetatilesFromRegion(t *testing.T) {
+	region := polygon.Region{polygon.Polygon{
+		latlong.LatLong{Lat: 55.9, Long: 37.3},
+		latlong.LatLong{Lat: 55.9, Long: 37.9},
+		latlong.LatLong{Lat: 55.5, Long: 37.3},
+	}}
+
+	zooms := []int{1, 14}
+	m := NewMetatilesFromRegion(zooms, region)
+	seen := make(map[string]bool)
+	for mt := range m.Iterate(context.Background()) {
+		seen[mt.Filepath("")] = true
+	}
+
+	tiles := make(map[string]bool)
+	for t := range NewFromRegion(zooms, region, "png") {
+		tiles[metatile.NewFromTile(t).Filepath("")] = true
+	}
+
+	if len(seen) != len(tiles) || m.Count() != len(tiles) {
+		t.Errorf("NewMetatilesFromRegion: expected %v metatiles, got %v, count %v", len(tiles), len(seen), m.Count())
+	}
+
+	for k := range tiles {
+		if !seen[k] {
+			t.Errorf("NewMetatilesFromRegion: metatile %v is missing", k)
+		}
+	}
+}
@@ -2,21 +2,23 @@
 package cache
 
 import (
+	"context"
 	"time"
 
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
 )
 
-// Reader provides interface for read tile data from metatiles cache.
+// Reader provides interface for read tile data from metatiles cache. Context carries request-scoped
+// logger (see logger.NewContext).
 type Reader interface {
-	Read(t tile.Tile) (data tile.Data, err error)
-	Check(t tile.Tile) (found bool, mtime time.Time)
+	Read(ctx context.Context, t tile.Tile) (data tile.Data, err error)
+	Check(ctx context.Context, t tile.Tile) (found bool, mtime time.Time)
 }
 
 // Writer provides interface for write metatile data data to cache.
 type Writer interface {
-	Write(m metatile.Metatile, data metatile.Data) error
+	Write(ctx context.Context, m metatile.Metatile, data metatile.Data) error
 }
 
 // ReadWriter includes Reader and Writer interfaces.
@@ -1,14 +1,17 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
 )
@@ -17,11 +20,23 @@ import (
 // cache.ReadWriter interface.
 type FileCache struct {
 	cfg    config.FileCache
-	logger *log.Logger
+	logger logger.Logger
+	stats  Stats
+}
+
+// Stats contains file cache statistics since start.
+type Stats struct {
+	// Count of metatiles found and not found by Check.
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Count of written metatiles, failed writes and size of written metatiles in bytes.
+	Writes      int64 `json:"writes"`
+	WriteErrors int64 `json:"write_errors"`
+	WriteBytes  int64 `json:"write_bytes"`
 }
 
 // NewFileCache creates new FileCache. Return error if cfg.RootDir does not exists.
-func NewFileCache(cfg config.FileCache, logger *log.Logger) (*FileCache, error) {
+func NewFileCache(cfg config.FileCache, logger logger.Logger) (*FileCache, error) {
 	if _, err := os.Stat(cfg.RootDir); os.IsNotExist(err) {
 		return nil, fmt.Errorf("NewFileCache: %v is not exist", cfg.RootDir)
 	}
@@ -35,10 +50,10 @@ func NewFileCache(cfg config.FileCache, logger *log.Logger) (*FileCache, error)
 }
 
 // Read reads tile data from metatile.
-func (fc *FileCache) Read(t tile.Tile) (data tile.Data, err error) {
+func (fc *FileCache) Read(ctx context.Context, t tile.Tile) (data tile.Data, err error) {
 	mt := metatile.NewFromTile(t)
 	path := mt.Filepath(fc.cfg.RootDir)
-	fc.logger.Printf("[DEBUG] FileCache: read %v from metatile %v", t, path)
+	logger.FromContext(ctx, fc.logger).Debug("FileCache: read", "tile", t, "metatile", path)
 
 	file, err := os.Open(path)
 	if err != nil {
@@ -55,25 +70,64 @@ func (fc *FileCache) Read(t tile.Tile) (data tile.Data, err error) {
 }
 
 // Check checks if tile in the file cache. If found, return found = true and mtime = modification time of file.
-func (fc *FileCache) Check(t tile.Tile) (found bool, mtime time.Time) {
+func (fc *FileCache) Check(ctx context.Context, t tile.Tile) (found bool, mtime time.Time) {
 	mt := metatile.NewFromTile(t)
 	path := mt.Filepath(fc.cfg.RootDir)
-	fc.logger.Printf("[DEBUG] FileCache: check %v", path)
+	logger.FromContext(ctx, fc.logger).Debug("FileCache: check", "metatile", path)
 
 	stat, err := os.Stat(path)
 	if !os.IsNotExist(err) {
+		atomic.AddInt64(&fc.stats.Hits, 1)
 		return true, stat.ModTime()
 	}
 
+	atomic.AddInt64(&fc.stats.Misses, 1)
 	return false, time.Time{}
 }
 
+// Stats returns file cache statistics.
+func (fc *FileCache) Stats() Stats {
+	return Stats{
+		Hits:        atomic.LoadInt64(&fc.stats.Hits),
+		Misses:      atomic.LoadInt64(&fc.stats.Misses),
+		Writes:      atomic.LoadInt64(&fc.stats.Writes),
+		WriteErrors: atomic.LoadInt64(&fc.stats.WriteErrors),
+		WriteBytes:  atomic.LoadInt64(&fc.stats.WriteBytes),
+	}
+}
+
+// CheckWritable returns error if root directory of file cache does not exist or is not writable.
+func (fc *FileCache) CheckWritable() error {
+	f, err := ioutil.TempFile(fc.cfg.RootDir, "check")
+	if err != nil {
+		return fmt.Errorf("FileCache: %v", err)
+	}
+	f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("FileCache: %v", err)
+	}
+
+	return nil
+}
+
+// RootDir returns root directory of file cache.
+func (fc *FileCache) RootDir() string {
+	return fc.cfg.RootDir
+}
+
 // Write writes metatile data to disk.
-func (fc *FileCache) Write(mt metatile.Metatile, data metatile.Data) error {
+func (fc *FileCache) Write(ctx context.Context, mt metatile.Metatile, data metatile.Data) (err error) {
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			atomic.AddInt64(&fc.stats.WriteErrors, 1)
+		}
+	}()
 	path := mt.Filepath(fc.cfg.RootDir)
-	fc.logger.Printf("FileCache: write %v", path)
+	logger.FromContext(ctx, fc.logger).Info("FileCache: write", "metatile", path)
 
-	err := os.MkdirAll(filepath.Dir(path), 0777)
+	err = os.MkdirAll(filepath.Dir(path), 0777)
 	if err != nil {
 		return fmt.Errorf("FileCache: %v", err)
 	}
@@ -98,6 +152,11 @@ func (fc *FileCache) Write(mt metatile.Metatile, data metatile.Data) error {
 		return fmt.Errorf("FileCache: %v", err)
 	}
 
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("FileCache: %v", err)
+	}
+
 	err = os.Rename(f.Name(), path)
 	if err != nil {
 		return fmt.Errorf("FileCache: %v", err)
@@ -107,5 +166,10 @@ func (fc *FileCache) Write(mt metatile.Metatile, data metatile.Data) error {
 		return fmt.Errorf("FileCache: %v", err)
 	}
 
+	zoom := strconv.Itoa(mt.Zoom)
+	writeDuration.Observe(time.Since(start).Seconds(), mt.Map, zoom)
+	writeBytes.Add(float64(stat.Size()), mt.Map, zoom)
+	atomic.AddInt64(&fc.stats.Writes, 1)
+	atomic.AddInt64(&fc.stats.WriteBytes, stat.Size())
 	return nil
 }
@@ -0,0 +1,12 @@
+package cache
+
+import (
+	"github.com/tierpod/metatiles-cacher/pkg/metrics"
+)
+
+var (
+	writeDuration = metrics.NewHistogram("metatiles_cache_write_duration_seconds",
+		"Duration of metatile writes to cache.", metrics.DefaultBuckets, "source", "zoom")
+	writeBytes = metrics.NewCounter("metatiles_cache_write_bytes_total",
+		"Size of metatiles written to cache in bytes.", "source", "zoom")
+)
@@ -4,8 +4,13 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"path"
+	"path/filepath"
+	"strings"
 
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
 	"github.com/tierpod/metatiles-cacher/pkg/polygon"
 
 	"gopkg.in/yaml.v2"
@@ -16,6 +21,37 @@ const (
 	DefaultMinZoom = 1
 	// DefaultMaxZoom is the default maximum zoom level.
 	DefaultMaxZoom = 18
+	// MaxZoom is the maximum allowed zoom level. Metatile path contains 5 hashes of 4 bits, so
+	// metatiles of higher zoom levels would have the same path.
+	MaxZoom = 20
+	// DefaultBreakerTimeout is the default circuit breaker timeout in seconds.
+	DefaultBreakerTimeout = 30
+	// DefaultRequestTimeout is the default timeout of request to remote source in seconds.
+	DefaultRequestTimeout = 30
+	// DefaultWorkers is the default count of fetch workers.
+	DefaultWorkers = 4
+	// DefaultQueueDepth is the default depth of fetch queue.
+	DefaultQueueDepth = 100
+	// DefaultJobsWorkers is the default count of jobs queue workers.
+	DefaultJobsWorkers = 2
+	// DefaultJobsHistory is the default count of finished jobs kept in the queue.
+	DefaultJobsHistory = 1000
+	// DefaultJobsMaxQueued is the default maximum count of queued jobs.
+	DefaultJobsMaxQueued = 100000
+	// DefaultPrefetchBudget is the default maximum count of prefetched metatiles per minute.
+	DefaultPrefetchBudget = 60
+	// DefaultShutdownTimeout is the default graceful shutdown timeout in seconds.
+	DefaultShutdownTimeout = 30
+)
+
+// Policies for tiles failed to fetch from remote source.
+const (
+	// PartialFail fails the whole metatile (default).
+	PartialFail = "fail"
+	// PartialEmpty stores empty entry for failed tile.
+	PartialEmpty = "empty"
+	// PartialBlank stores Partial.BlankTile data for failed tile.
+	PartialBlank = "blank"
 )
 
 // Config is the root of configuration.
@@ -24,6 +60,7 @@ type Config struct {
 	Log       Log       `yaml:"log"`
 	FileCache FileCache `yaml:"filecache"`
 	Fetch     Fetch     `yaml:"fetch"`
+	Jobs      Jobs      `yaml:"jobs"`
 	Sources   []Source  `yaml:"sources"`
 }
 
@@ -48,8 +85,19 @@ type Service struct {
 	UseWriter bool `yaml:"use_writer"`
 	// Token for XToken handler.
 	XToken string `yaml:"x_token"`
+	// Token for /metrics in "Authorization: Bearer" header. If empty, /metrics is not protected.
+	MetricsToken string `yaml:"metrics_token"`
 	// Cache-Control: max-age value in seconds.
 	MaxAge int `yaml:"max_age"`
+	// Time in seconds between shutdown signal and closing listener, while /readyz reports not ready.
+	ShutdownDelay int `yaml:"shutdown_delay"`
+	// Time in seconds for finishing requests and running fetchings on shutdown.
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// Check that remote sources are reachable in /readyz?
+	ReadyUpstreams bool `yaml:"ready_upstreams"`
+	// Public URL of service, used in tile URLs of TileJSON documents. If empty, URL is taken from
+	// request.
+	PublicURL string `yaml:"public_url"`
 }
 
 // Zoom contains min and max zoom levels.
@@ -58,10 +106,53 @@ type Zoom struct {
 	Max int `yaml:"max"`
 }
 
+func (z Zoom) check() error {
+	if z.Min < 0 || z.Max > MaxZoom || z.Min > z.Max {
+		return fmt.Errorf("wrong range %v-%v", z.Min, z.Max)
+	}
+
+	return nil
+}
+
 // Log contains logger configuration.
 type Log struct {
 	Datetime bool `yaml:"datetime"`
 	Debug    bool `yaml:"debug"`
+	// Log format: text (default) or json.
+	Format string `yaml:"format"`
+	// Path to access log file. If empty, access log is written to stdout.
+	AccessFile string `yaml:"access_file"`
+	// Access log format: common, combined (default) or json.
+	AccessFormat string `yaml:"access_format"`
+	// IP addresses or CIDR networks of proxies, which X-Forwarded-For header is trusted.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// TrustedNetworks parses TrustedProxies. IP addresses are converted to single address networks.
+func (l Log) TrustedNetworks() ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, p := range l.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted_proxies: wrong address %v", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %v", err)
+		}
+		result = append(result, n)
+	}
+
+	return result, nil
 }
 
 // FileCache contains file cache configuration.
@@ -73,15 +164,189 @@ type FileCache struct {
 type Fetch struct {
 	UserAgent    string `yaml:"user_agent"`
 	QueueTimeout int    `yaml:"queue_timeout"`
+	// Timeout of request to remote source in seconds. Timed out request is the upstream failure.
+	RequestTimeout int `yaml:"request_timeout"`
+	// Count of metatiles fetching at the same time.
+	Workers int `yaml:"workers"`
+	// Count of metatiles waiting for free worker, for each priority class. If queue is full, new
+	// metatiles are rejected.
+	QueueDepth int `yaml:"queue_depth"`
+	// Maximum count of workers for each priority class.
+	Shares Shares `yaml:"shares"`
+	// Save negative cache to this file and load it on start. If empty, cache is kept in memory only.
+	NegativeCacheFile string `yaml:"negative_cache_file"`
+}
+
+// Jobs contains persistent jobs queue configuration.
+type Jobs struct {
+	// Path to jobs log file. If not set, FileCache.RootDir/.jobs.log is used.
+	File string `yaml:"file"`
+	// Count of workers, taking jobs from the queue.
+	Workers int `yaml:"workers"`
+	// Count of finished jobs kept in the queue.
+	History int `yaml:"history"`
+	// Maximum count of queued jobs. New jobs are rejected if it is reached.
+	MaxQueued int `yaml:"max_queued"`
+}
+
+// Shares contains maximum count of fetch workers for each priority class. Zero value means default:
+// all workers for Interactive, half of workers for Fetch, quarter of workers for Background and
+// Seed (at least one).
+type Shares struct {
+	Interactive int `yaml:"interactive"`
+	Fetch       int `yaml:"fetch"`
+	Background  int `yaml:"background"`
+	Seed        int `yaml:"seed"`
+}
+
+func (s *Shares) setDefaults(workers int) {
+	share := func(v *int, d int) {
+		if *v == 0 {
+			*v = d
+		}
+		if *v < 1 {
+			*v = 1
+		}
+	}
+
+	share(&s.Interactive, workers)
+	share(&s.Fetch, workers/2)
+	share(&s.Background, workers/4)
+	share(&s.Seed, workers/4)
 }
 
 // Source contains source configuration.
 type Source struct {
-	Name     string `yaml:"name"`
-	URL      string `yaml:"url"`
-	CacheDir string `yaml:"cache_dir"`
-	Zoom     Zoom   `yaml:"zoom"`
-	Region   Region `yaml:"region"`
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Fallback URL templates, used in given order if URL fails.
+	URLs []string `yaml:"urls"`
+	// Use fallback URLs for tiles not found on previous remote source?
+	FailoverNotFound bool   `yaml:"failover_not_found"`
+	CacheDir         string `yaml:"cache_dir"`
+	// Tile extension on remote source. If not set, detected from URL.
+	Ext      string   `yaml:"ext"`
+	Zoom     Zoom     `yaml:"zoom"`
+	Region   Region   `yaml:"region"`
+	Validate Validate `yaml:"validate"`
+	Partial  Partial  `yaml:"partial"`
+	Negative Negative `yaml:"negative"`
+	Breaker  Breaker  `yaml:"breaker"`
+	Prefetch Prefetch `yaml:"prefetch"`
+	// Attribution shown by clients, e.g. in TileJSON document.
+	Attribution string `yaml:"attribution"`
+}
+
+// Prefetch contains configuration of prefetching metatiles around fetched metatile. Prefetching is
+// disabled, if Neighbours and Zoom are false.
+type Prefetch struct {
+	// Prefetch adjacent metatiles on the same zoom level?
+	Neighbours bool `yaml:"neighbours"`
+	// Prefetch child metatiles on the next zoom level and parent metatile on the previous one?
+	Zoom bool `yaml:"zoom"`
+	// Maximum count of prefetched metatiles per minute.
+	Budget int `yaml:"budget"`
+}
+
+// Enabled returns true if prefetching is enabled.
+func (p Prefetch) Enabled() bool {
+	return p.Neighbours || p.Zoom
+}
+
+// Breaker contains circuit breaker configuration.
+type Breaker struct {
+	// Open circuit breaker after this count of consecutive failures. Zero value disables breaker.
+	Failures int `yaml:"failures"`
+	// Time in seconds before probing remote source again.
+	Timeout int `yaml:"timeout"`
+}
+
+// Negative contains ttl in seconds for negative cache entries. Zero value disables caching.
+type Negative struct {
+	// TTL for tiles and metatiles not found on remote source.
+	TTL int `yaml:"ttl"`
+	// TTL for metatiles failed to fetch due to other errors.
+	ErrorTTL int `yaml:"error_ttl"`
+}
+
+// Validate contains rules for checking tiles fetched from remote source. Tile data is always checked
+// against the format of Source.Ext.
+type Validate struct {
+	// Allowed media types of Content-Type header. If empty, header is not checked.
+	ContentType []string `yaml:"content_type"`
+	// Minimum and maximum tile size in bytes. Zero value disables the check.
+	MinSize int `yaml:"min_size"`
+	MaxSize int `yaml:"max_size"`
+}
+
+// Upstreams returns ordered list of URL templates: URL and fallback URLs.
+func (s Source) Upstreams() []string {
+	var result []string
+	if s.URL != "" {
+		result = append(result, s.URL)
+	}
+
+	return append(result, s.URLs...)
+}
+
+// Partial contains policy for tiles failed to fetch from remote source (not found, invalid or
+// network error).
+type Partial struct {
+	// Policy is one of PartialFail (default), PartialEmpty, PartialBlank.
+	Policy string `yaml:"policy"`
+	// Path to tile file for PartialBlank policy, relative to working directory.
+	BlankTile string `yaml:"blank_tile"`
+	// Blank contains BlankTile data, read on config loading.
+	Blank []byte `yaml:"-"`
+}
+
+func (p *Partial) readFile() error {
+	switch p.Policy {
+	case "", PartialFail, PartialEmpty:
+		return nil
+	case PartialBlank:
+	default:
+		return fmt.Errorf("partial: unknown policy: %v", p.Policy)
+	}
+
+	if p.BlankTile == "" {
+		return fmt.Errorf("partial: blank_tile is not set for %v policy", p.Policy)
+	}
+
+	data, err := ioutil.ReadFile(p.BlankTile)
+	if err != nil {
+		return fmt.Errorf("partial: %v", err)
+	}
+
+	p.Blank = data
+	return nil
+}
+
+// ZoomRange returns minimum and maximum zoom levels for the point. If point is inside source region,
+// returns region zoom levels.
+func (s Source) ZoomRange(ll latlong.LatLong) (min, max int) {
+	if s.HasRegion() && s.Region.Polygons.Contains(ll) {
+		return s.Region.Zoom.Min, s.Region.Zoom.Max
+	}
+
+	return s.Zoom.Min, s.Zoom.Max
+}
+
+// ZoomLimits returns minimum and maximum zoom levels served at any point: source zoom levels,
+// extended by region zoom levels.
+func (s Source) ZoomLimits() (min, max int) {
+	min, max = s.Zoom.Min, s.Zoom.Max
+	if !s.HasRegion() {
+		return min, max
+	}
+
+	if s.Region.Zoom.Min < min {
+		min = s.Region.Zoom.Min
+	}
+	if s.Region.Zoom.Max > max {
+		max = s.Region.Zoom.Max
+	}
+	return min, max
 }
 
 // HasRegion return true if source has region section. Otherwise return false.
@@ -101,24 +366,34 @@ type Region struct {
 }
 
 func (r *Region) readFile() error {
+	region, err := ReadRegion(r.File)
+	if err != nil {
+		return err
+	}
+
+	r.Polygons = region
+	return nil
+}
+
+// ReadRegion reads region from yaml or kml file.
+func ReadRegion(file string) (polygon.Region, error) {
 	var region polygon.Region
 	var err error
 
-	switch path.Ext(r.File) {
+	switch path.Ext(file) {
 	case ".yaml", ".yml":
-		region, err = readYAML(r.File)
+		region, err = readYAML(file)
 	case ".kml":
-		region, err = readKML(r.File)
+		region, err = readKML(file)
 	default:
-		return fmt.Errorf("readFile: unknown file format: %v", path.Ext(r.File))
+		return nil, fmt.Errorf("readFile: unknown file format: %v", path.Ext(file))
 	}
 
 	if err != nil {
-		return fmt.Errorf("readFile: %v", err)
+		return nil, fmt.Errorf("readFile: %v", err)
 	}
 
-	r.Polygons = region
-	return nil
+	return region, nil
 }
 
 // Load loads yaml file and creates new service configuration.
@@ -135,10 +410,52 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("unmarshal config: %v", err)
 	}
 
+	if c.Log.Format == "" {
+		c.Log.Format = "text"
+	}
+
+	if c.Log.AccessFormat == "" {
+		c.Log.AccessFormat = "combined"
+	}
+
+	if c.Service.ShutdownTimeout == 0 {
+		c.Service.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
 	if c.Fetch.QueueTimeout == 0 {
 		c.Fetch.QueueTimeout = 30
 	}
 
+	if c.Fetch.RequestTimeout == 0 {
+		c.Fetch.RequestTimeout = DefaultRequestTimeout
+	}
+
+	if c.Fetch.Workers == 0 {
+		c.Fetch.Workers = DefaultWorkers
+	}
+
+	if c.Fetch.QueueDepth == 0 {
+		c.Fetch.QueueDepth = DefaultQueueDepth
+	}
+
+	c.Fetch.Shares.setDefaults(c.Fetch.Workers)
+
+	if c.Jobs.File == "" {
+		c.Jobs.File = filepath.Join(c.FileCache.RootDir, ".jobs.log")
+	}
+
+	if c.Jobs.Workers == 0 {
+		c.Jobs.Workers = DefaultJobsWorkers
+	}
+
+	if c.Jobs.History == 0 {
+		c.Jobs.History = DefaultJobsHistory
+	}
+
+	if c.Jobs.MaxQueued == 0 {
+		c.Jobs.MaxQueued = DefaultJobsMaxQueued
+	}
+
 	for i := range c.Sources {
 		// if Source.Zoom is not set, use defaults.
 		if c.Sources[i].Zoom.Min == 0 && c.Sources[i].Zoom.Max == 0 {
@@ -151,6 +468,29 @@ func Load(path string) (*Config, error) {
 			c.Sources[i].CacheDir = c.Sources[i].Name
 		}
 
+		upstreams := c.Sources[i].Upstreams()
+		if len(upstreams) == 0 {
+			return nil, fmt.Errorf("source %v: url is not set", c.Sources[i].Name)
+		}
+
+		// if Source.Ext is not set, try to detect it from the first URL.
+		if c.Sources[i].Ext == "" {
+			c.Sources[i].Ext = urlExt(upstreams[0])
+		}
+
+		if c.Sources[i].Breaker.Failures > 0 && c.Sources[i].Breaker.Timeout == 0 {
+			c.Sources[i].Breaker.Timeout = DefaultBreakerTimeout
+		}
+
+		if c.Sources[i].Prefetch.Enabled() && c.Sources[i].Prefetch.Budget == 0 {
+			c.Sources[i].Prefetch.Budget = DefaultPrefetchBudget
+		}
+
+		err = c.Sources[i].Partial.readFile()
+		if err != nil {
+			return nil, err
+		}
+
 		if c.Sources[i].HasRegion() {
 			// if Source.Region has "File" section read coordinates from given file to Region.Polygons struct
 			err = c.Sources[i].Region.readFile()
@@ -164,5 +504,62 @@ func Load(path string) (*Config, error) {
 			}
 		}
 	}
+
+	if err = c.check(); err != nil {
+		return nil, err
+	}
+
 	return &c, nil
 }
+
+// check validates configuration after defaults are applied.
+func (c Config) check() error {
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("log: unknown format: %v", c.Log.Format)
+	}
+
+	switch c.Log.AccessFormat {
+	case "common", "combined", "json":
+	default:
+		return fmt.Errorf("log: unknown access_format: %v", c.Log.AccessFormat)
+	}
+
+	if _, err := c.Log.TrustedNetworks(); err != nil {
+		return fmt.Errorf("log: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, src := range c.Sources {
+		if src.Name == "" {
+			return fmt.Errorf("source: name is not set")
+		}
+		if names[src.Name] {
+			return fmt.Errorf("source %v: duplicate name", src.Name)
+		}
+		names[src.Name] = true
+
+		if err := src.Zoom.check(); err != nil {
+			return fmt.Errorf("source %v: zoom: %v", src.Name, err)
+		}
+
+		if src.HasRegion() {
+			if err := src.Region.Zoom.check(); err != nil {
+				return fmt.Errorf("source %v: region zoom: %v", src.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// urlExt returns extension of path part of URL template, or empty string if it can not be detected.
+func urlExt(tmpl string) string {
+	u, err := url.Parse(tmpl)
+	if err != nil {
+		return ""
+	}
+
+	return path.Ext(u.Path)
+}
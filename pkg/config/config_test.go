@@ -32,6 +32,26 @@ func TestLoad(t *testing.T) {
 	//fmt.Printf("%+v\n", config)
 }
 
+func TestLoadPartial(t *testing.T) {
+	_, err := Load("testdata/config4.yaml")
+	if err == nil || err.Error() != "partial: unknown policy: unknown" {
+		t.Errorf("Load: expected \"unknown policy\" error, got %v", err)
+	}
+
+	config, err := Load("testdata/config5.yaml")
+	if err != nil {
+		t.Fatalf("Load: expected no error, got %v", err)
+	}
+
+	source, _ := config.Source("testsrc1")
+	if source.Ext != ".png" {
+		t.Errorf("Load: expected Ext \".png\", got %q", source.Ext)
+	}
+	if len(source.Partial.Blank) != 8 {
+		t.Errorf("Load: expected blank tile with 8 bytes, got %v", len(source.Partial.Blank))
+	}
+}
+
 func TestSource(t *testing.T) {
 	testSource := Source{
 		Name:     "testsrc1",
@@ -101,3 +121,56 @@ func ExampleLoad() {
 	// source.Region.Zoom: {Min:1 Max:18}
 	// ---
 }
+
+func TestURLExt(t *testing.T) {
+	testData := []struct {
+		url string
+		ext string
+	}{
+		{"http://tilesrv/style/{z}/{x}/{y}.png", ".png"},
+		{"http://tilesrv/style/{z}/{x}/{y}.mvt?api_key=123", ".mvt"},
+		{"http://tilesrv1/style/{tile}", ""},
+	}
+
+	for _, tt := range testData {
+		ext := urlExt(tt.url)
+		if ext != tt.ext {
+			t.Errorf("urlExt(%v): expected %q, got %q", tt.url, tt.ext, ext)
+		}
+	}
+}
+
+func ExampleReadRegion() {
+	region, err := ReadRegion("testdata/test_region.yaml")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(len(region) > 0)
+
+	_, err = ReadRegion("testdata/config.yaml.bak")
+	fmt.Println(err)
+
+	// Output:
+	// true
+	// readFile: unknown file format: .bak
+}
+
+func TestZoomCheck(t *testing.T) {
+	testData := []struct {
+		zoom Zoom
+		ok   bool
+	}{
+		{Zoom{Min: 0, Max: 20}, true},
+		{Zoom{Min: 10, Max: 9}, false},
+		{Zoom{Min: -1, Max: 10}, false},
+		// metatile path can not contain higher zoom levels
+		{Zoom{Min: 1, Max: 21}, false},
+	}
+
+	for _, tt := range testData {
+		if err := tt.zoom.check(); (err == nil) != tt.ok {
+			t.Errorf("check(%+v): expected ok=%v, got error %v", tt.zoom, tt.ok, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change describes changed configuration option. Path is the dot-separated yaml path of option,
+// sources are addressed by name: "sources.style.zoom.max". Old is empty for added and New is empty
+// for removed options. Old and New are equal for values, which are too long for logging (region
+// polygons, blank tile data).
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%v: added", c.Path)
+	case c.New == "":
+		return fmt.Sprintf("%v: removed", c.Path)
+	case c.Old == c.New:
+		return fmt.Sprintf("%v: changed", c.Path)
+	default:
+		return fmt.Sprintf("%v: %v -> %v", c.Path, c.Old, c.New)
+	}
+}
+
+// Diff returns list of options changed from old to new configuration.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	a, b := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	for i := 0; i < a.NumField(); i++ {
+		// sources are compared by name below
+		if f := a.Type().Field(i); f.Name != "Sources" {
+			diffValues(&changes, yamlName(f), a.Field(i), b.Field(i))
+		}
+	}
+
+	for _, src := range old.Sources {
+		n, err := new.Source(src.Name)
+		if err != nil {
+			changes = append(changes, Change{Path: "sources." + src.Name, Old: "source"})
+			continue
+		}
+		diffValues(&changes, "sources."+src.Name, reflect.ValueOf(src), reflect.ValueOf(n))
+	}
+
+	for _, src := range new.Sources {
+		if _, err := old.Source(src.Name); err != nil {
+			changes = append(changes, Change{Path: "sources." + src.Name, New: "source"})
+		}
+	}
+
+	return changes
+}
+
+// diffValues appends changes between struct fields or values a and b to changes.
+func diffValues(changes *[]Change, path string, a, b reflect.Value) {
+	if a.Kind() == reflect.Struct {
+		for i := 0; i < a.NumField(); i++ {
+			diffValues(changes, path+"."+yamlName(a.Type().Field(i)), a.Field(i), b.Field(i))
+		}
+		return
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+
+	format := "%v"
+	switch a.Kind() {
+	case reflect.String:
+		format = "%q"
+	case reflect.Slice, reflect.Map:
+		if a.Type().Elem().Kind() != reflect.String {
+			*changes = append(*changes, Change{Path: path, Old: "...", New: "..."})
+			return
+		}
+		format = "%q"
+	}
+
+	*changes = append(*changes, Change{Path: path, Old: fmt.Sprintf(format, a.Interface()), New: fmt.Sprintf(format, b.Interface())})
+}
+
+// yamlName returns name of struct field in yaml file.
+func yamlName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "" || name == "-" {
+		return strings.ToLower(f.Name)
+	}
+
+	return name
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds current configuration, which can be reloaded from file. Configuration is replaced
+// atomically, so all readers get either old or new configuration.
+type Store struct {
+	path  string
+	mx    sync.Mutex
+	value atomic.Value
+}
+
+// NewStore creates new Store with configuration c loaded from path.
+func NewStore(path string, c *Config) *Store {
+	s := &Store{path: path}
+	s.value.Store(c)
+	return s
+}
+
+// Get returns current configuration. Returned configuration must not be modified.
+func (s *Store) Get() *Config {
+	return s.value.Load().(*Config)
+}
+
+// Reload loads configuration and region files from path again and replaces current configuration
+// with it. Returns list of changed options. If configuration is invalid, returns error and keeps
+// current configuration.
+func (s *Store) Reload() ([]Change, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	c, err := Load(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Diff(s.Get(), c)
+	s.value.Store(c)
+	return changes, nil
+}
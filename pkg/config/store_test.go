@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func ExampleDiff() {
+	old := &Config{
+		Service: Service{Bind: ":8080", MaxAge: 3600},
+		Sources: []Source{{Name: "style", Zoom: Zoom{Min: 1, Max: 18}}, {Name: "old"}},
+	}
+	new := &Config{
+		Service: Service{Bind: ":8080", MaxAge: 86400},
+		Sources: []Source{{Name: "style", Zoom: Zoom{Min: 1, Max: 16}}, {Name: "new"}},
+	}
+
+	for _, c := range Diff(old, new) {
+		fmt.Println(c)
+	}
+
+	// Output:
+	// service.max_age: 3600 -> 86400
+	// sources.style.zoom.max: 18 -> 16
+	// sources.old: removed
+	// sources.new: added
+}
+
+func TestStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	write := func(data string) {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("sources:\n  - name: style\n    url: http://tilesrv/{z}/{x}/{y}.png\n")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	s := NewStore(path, c)
+
+	// invalid zoom range, old configuration is kept
+	write("sources:\n  - name: style\n    url: http://tilesrv/{z}/{x}/{y}.png\n    zoom: {min: 10, max: 5}\n")
+	if _, err = s.Reload(); err == nil {
+		t.Errorf("Reload: expected error, got nil")
+	}
+	if s.Get() != c {
+		t.Errorf("Reload: expected old configuration after error")
+	}
+
+	write("sources:\n  - name: style\n    url: http://tilesrv/{z}/{x}/{y}.png\n    zoom: {min: 1, max: 10}\n")
+	changes, err := s.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(changes) != 1 || changes[0].String() != "sources.style.zoom.max: 18 -> 10" {
+		t.Errorf("Reload: unexpected changes %v", changes)
+	}
+
+	if src, _ := s.Get().Source("style"); src.Zoom.Max != 10 {
+		t.Errorf("Get: expected new configuration, got zoom %v", src.Zoom)
+	}
+}
@@ -0,0 +1,153 @@
+package fetch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+)
+
+// Circuit breaker states.
+const (
+	// BreakerClosed means that metatiles are fetched from remote source as usual.
+	BreakerClosed = "closed"
+	// BreakerOpen means that remote source is unhealthy and fetching fails fast.
+	BreakerOpen = "open"
+	// BreakerHalfOpen means that one probe fetching is allowed to check if remote source recovered.
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitOpenError is the error returned if circuit breaker of source is open.
+type CircuitOpenError struct {
+	Source  string
+	RetryAt time.Time
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for source %v is open until %v", e.Source, e.RetryAt.Format(time.RFC3339))
+}
+
+// IsCircuitOpen returns true if err is CircuitOpenError.
+func IsCircuitOpen(err error) bool {
+	_, ok := err.(CircuitOpenError)
+	return ok
+}
+
+// BreakerState contains circuit breaker state of source.
+type BreakerState struct {
+	Source string `json:"source"`
+	State  string `json:"state"`
+	// Count of consecutive failures.
+	Failures int       `json:"failures"`
+	RetryAt  time.Time `json:"retry_at,omitempty"`
+}
+
+type breaker struct {
+	BreakerState
+	probing bool
+}
+
+// breakers contains circuit breakers for all sources.
+type breakers struct {
+	mx sync.Mutex
+	m  map[string]*breaker
+}
+
+func newBreakers() *breakers {
+	return &breakers{
+		m: make(map[string]*breaker),
+	}
+}
+
+func (b *breakers) get(name string) *breaker {
+	br, found := b.m[name]
+	if !found {
+		br = &breaker{BreakerState: BreakerState{Source: name, State: BreakerClosed}}
+		b.m[name] = br
+	}
+	return br
+}
+
+// allow returns CircuitOpenError if fetching from src is not allowed now. In half-open state only
+// one probe is allowed. Caller must report result with success or failure, if allowed.
+func (b *breakers) allow(src config.Source) error {
+	if src.Breaker.Failures == 0 {
+		return nil
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	br := b.get(src.Name)
+	switch br.State {
+	case BreakerOpen:
+		if time.Now().Before(br.RetryAt) {
+			return CircuitOpenError{Source: src.Name, RetryAt: br.RetryAt}
+		}
+		br.State = BreakerHalfOpen
+		br.probing = true
+	case BreakerHalfOpen:
+		if br.probing {
+			return CircuitOpenError{Source: src.Name, RetryAt: br.RetryAt}
+		}
+		br.probing = true
+	}
+
+	return nil
+}
+
+// success closes circuit breaker of src.
+func (b *breakers) success(src config.Source) {
+	if src.Breaker.Failures == 0 {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	br := b.get(src.Name)
+	br.State = BreakerClosed
+	br.Failures = 0
+	br.RetryAt = time.Time{}
+	br.probing = false
+}
+
+// failure opens circuit breaker of src after src.Breaker.Failures consecutive failures, or if probe
+// failed in half-open state.
+func (b *breakers) failure(src config.Source) {
+	if src.Breaker.Failures == 0 {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	br := b.get(src.Name)
+	br.Failures++
+	br.probing = false
+	if br.State == BreakerHalfOpen || br.Failures >= src.Breaker.Failures {
+		br.State = BreakerOpen
+		br.RetryAt = time.Now().Add(time.Duration(src.Breaker.Timeout) * time.Second)
+	}
+}
+
+// states returns copy of circuit breakers states, sorted by source name.
+func (b *breakers) states() []BreakerState {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var result []BreakerState
+	for _, br := range b.m {
+		result = append(result, br.BreakerState)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Source < result[j].Source })
+	return result
+}
+
+// Breakers returns circuit breakers states of sources used by fetcher.
+func (f *Fetch) Breakers() []BreakerState {
+	return f.breakers.states()
+}
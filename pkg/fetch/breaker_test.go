@@ -0,0 +1,53 @@
+package fetch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+)
+
+func TestBreakers(t *testing.T) {
+	b := newBreakers()
+	src := config.Source{Name: "src", Breaker: config.Breaker{Failures: 2, Timeout: 0}}
+
+	// disabled breaker always allows fetching
+	disabled := config.Source{Name: "disabled"}
+	for i := 0; i < 5; i++ {
+		b.failure(disabled)
+	}
+	if err := b.allow(disabled); err != nil {
+		t.Errorf("allow: expected nil for disabled breaker, got %v", err)
+	}
+
+	b.failure(src)
+	if err := b.allow(src); err != nil {
+		t.Errorf("allow: expected nil after 1 failure, got %v", err)
+	}
+
+	b.failure(src)
+	src.Breaker.Timeout = 60
+	b.failure(src)
+	if err := b.allow(src); !IsCircuitOpen(err) {
+		t.Errorf("allow: expected CircuitOpenError, got %v", err)
+	}
+
+	// timeout expired: allow only one probe
+	b.m["src"].RetryAt = time.Now().Add(-time.Second)
+	if err := b.allow(src); err != nil {
+		t.Errorf("allow: expected probe is allowed, got %v", err)
+	}
+	if err := b.allow(src); !IsCircuitOpen(err) {
+		t.Errorf("allow: expected second probe is not allowed, got %v", err)
+	}
+
+	b.success(src)
+	if err := b.allow(src); err != nil {
+		t.Errorf("allow: expected nil after success, got %v", err)
+	}
+
+	states := b.states()
+	if len(states) != 1 || states[0].State != BreakerClosed {
+		t.Errorf("states: unexpected result %+v", states)
+	}
+}
@@ -3,50 +3,88 @@
 package fetch
 
 import (
-	"log"
+	"context"
 
 	"github.com/tierpod/metatiles-cacher/pkg/cache"
 	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/negcache"
 	"github.com/tierpod/metatiles-cacher/pkg/queue"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
 )
 
 // Fetcher provides interface for fetch tile and metatile data.
 type Fetcher interface {
-	Tile(t tile.Tile, URLTmpl string) (tile.Data, error)
-	Metatile(mt metatile.Metatile, URLTmpl string) (metatile.Data, error)
+	Tile(ctx context.Context, t tile.Tile, src config.Source) (tile.Data, error)
+	Metatile(ctx context.Context, mt metatile.Metatile, src config.Source) (metatile.Data, error)
 }
 
 // CacheWaitWriter provides interface for fetching metatile data, writing it to cache and waiting
 // for complete. All metatiles stored in fetching queue. If metatile already in queue, do not run
-// new fetching, waiting for complete.
+// new fetching, waiting for complete and getting its result.
 type CacheWaitWriter interface {
-	// TileWaitWriteToCache(t tile.Tile, URLTmpl string, w cache.Writer) error
-	MetatileWaitWriteToCache(mt metatile.Metatile, URLTmpl string, w cache.Writer) error
-}
-
-// CacheWriter provides interface for fetching metatile data and writing it to cache. All metatiles
-// stored in fetching queue. If metatile already in queue, do not run new fetching, return
-// ErrQueueHasKey.
-type CacheWriter interface {
-	// TileWriteToCache(t tile.Tile, URLTmpl string, w cache.Writer) error
-	MetatileWriteToCache(mt metatile.Metatile, URLTmpl string, w cache.Writer) error
+	// TileWaitWriteToCache(ctx context.Context, t tile.Tile, src config.Source, w cache.Writer) error
+	MetatileWaitWriteToCache(ctx context.Context, mt metatile.Metatile, src config.Source, w cache.Writer) error
 }
 
 // Fetch is the basic struct for fetcher.
 type Fetch struct {
-	logger *log.Logger
-	queue  *queue.Uniq
-	cfg    config.Fetch
+	logger    logger.Logger
+	queue     *queue.Group
+	negative  *negcache.Cache
+	upstreams *upstreams
+	breakers  *breakers
+	scheduler *scheduler
+	prefetch  *budgets
+	cfg       config.Fetch
 }
 
-// New creates new Fetch.
-func New(cfg config.Fetch, logger *log.Logger) *Fetch {
-	q := queue.NewUniq()
-	return &Fetch{
-		logger: logger,
-		queue:  q,
-		cfg:    cfg,
+// New creates new Fetch and starts cfg.Workers fetch workers. Expired entries of negative cache are
+// purged periodically. If cfg.NegativeCacheFile is set, load negative cache from this file and save
+// it periodically.
+func New(cfg config.Fetch, logger logger.Logger) *Fetch {
+	q := queue.NewGroup()
+	shares := [numPriorities]int{cfg.Shares.Interactive, cfg.Shares.Fetch, cfg.Shares.Background, cfg.Shares.Seed}
+	f := &Fetch{
+		logger:    logger,
+		queue:     q,
+		negative:  negcache.New(),
+		upstreams: newUpstreams(),
+		breakers:  newBreakers(),
+		prefetch:  newBudgets(),
+		scheduler: newScheduler(cfg.Workers, cfg.QueueDepth, shares),
+		cfg:       cfg,
+	}
+
+	if cfg.NegativeCacheFile != "" {
+		if err := f.negative.Load(cfg.NegativeCacheFile); err != nil {
+			logger.Error("Fetch: load negative cache", "error", err)
+		}
 	}
+	go f.negativeLoop()
+
+	return f
+}
+
+// Shutdown stops accepting new fetchings, cancels fetchings waiting in the queue with ErrShutdown
+// and waits for running fetchings and writings until ctx is done. Negative cache is saved after
+// that.
+func (f *Fetch) Shutdown(ctx context.Context) error {
+	err := f.scheduler.shutdown(ctx)
+	if serr := f.SaveNegative(); serr != nil {
+		f.logger.Error("Fetch: save negative cache", "error", serr)
+	}
+
+	return err
+}
+
+// QueueLen returns count of metatiles waiting for free worker.
+func (f *Fetch) QueueLen() int {
+	return f.scheduler.len()
+}
+
+// QueueStats returns count of pending and running metatiles for each priority class.
+func (f *Fetch) QueueStats() []QueueStat {
+	return f.scheduler.stats()
 }
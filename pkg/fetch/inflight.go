@@ -0,0 +1,52 @@
+package fetch
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// InFlight contains information about metatile fetching in progress.
+type InFlight struct {
+	Key    string `json:"key"`
+	Source string `json:"source"`
+	// State is "queued" if fetching waits for free worker, or "running".
+	State    string        `json:"state"`
+	Priority string        `json:"priority,omitempty"`
+	Age      time.Duration `json:"-"`
+	// Count of callers waiting for result.
+	Waiters int `json:"waiters"`
+}
+
+// MarshalJSON implements json.Marshaler interface. Age is formatted as duration string.
+func (i InFlight) MarshalJSON() ([]byte, error) {
+	type inFlight InFlight
+	return json.Marshal(struct {
+		inFlight
+		Age string `json:"age"`
+	}{inFlight(i), i.Age.Round(time.Millisecond).String()})
+}
+
+// InFlight returns metatiles fetching now or waiting in the queue, sorted by key.
+func (f *Fetch) InFlight() []InFlight {
+	flights := f.queue.Flights()
+	result := make([]InFlight, 0, len(flights))
+	for _, fl := range flights {
+		i := InFlight{
+			Key:     fl.Key,
+			Source:  strings.SplitN(fl.Key, "/", 2)[0],
+			State:   "running",
+			Age:     fl.Age,
+			Waiters: fl.Waiters,
+		}
+
+		if prio, found := f.scheduler.pendingPriority(fl.Key); found {
+			i.State = "queued"
+			i.Priority = prio.String()
+		}
+
+		result = append(result, i)
+	}
+
+	return result
+}
@@ -0,0 +1,42 @@
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+func TestInFlight(t *testing.T) {
+	// fetcher without workers: metatiles wait in the queue until shutdown
+	f := New(config.Fetch{QueueDepth: 10}, logger.New(ioutil.Discard, logger.Options{}))
+	mt := metatile.NewFromTile(tile.Tile{Map: "style", Zoom: 10, X: 0, Y: 0})
+	fl, _ := f.Start(context.Background(), mt, config.Source{Name: "style"}, nil, PriorityBackground)
+
+	var result []InFlight
+	for i := 0; i < 100; i++ {
+		if result = f.InFlight(); len(result) == 1 && result[0].State == "queued" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(result) != 1 {
+		t.Fatalf("InFlight: expected 1 metatile, got %v", result)
+	}
+	if r := result[0]; r.Key != mt.Filepath("") || r.Source != "style" || r.State != "queued" || r.Priority != "background" {
+		t.Errorf("InFlight: unexpected result %+v", r)
+	}
+
+	if err := f.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if _, err := fl.Wait(context.Background()); err != ErrShutdown {
+		t.Errorf("Wait: expected ErrShutdown, got %v", err)
+	}
+}
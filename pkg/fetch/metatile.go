@@ -1,100 +1,235 @@
 package fetch
 
 import (
-	"errors"
-	"strconv"
+	"context"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
 	"github.com/tierpod/metatiles-cacher/pkg/httpclient"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/queue"
 )
 
-// ErrQueueHasKey contains error message if queue already has item with key.
-var ErrQueueHasKey = errors.New("queue already has item with this key")
-
-// Metatile fetchs metatile data, using URLTmpl as template with placeholders: {z} {x} {y}.
-func (f *Fetch) Metatile(mt metatile.Metatile, URLTmpl string) (metatile.Data, error) {
+// Metatile fetchs metatile data from src upstreams, using URL templates with placeholders:
+// {z} {x} {y}. Each tile is validated with src rules.
+//
+// Upstreams are used in configured order, skipping upstreams marked as down. If upstream fails
+// (network error, unexpected response status), the whole metatile is fetched from the next one. If
+// src.FailoverNotFound is set, tiles not found or invalid are fetched from the next upstreams too.
+//
+// Missing tiles are handled by src.Partial policy: fail the whole metatile, store empty entry or
+// store blank tile. If all tiles are missing and not all of them were not found, remote source is
+// probably broken and metatile fails regardless of the policy.
+//
+// Failed metatiles are stored in the negative cache with ttl from src.Negative and are not fetched
+// again until ttl expires. If all upstreams fail src.Breaker.Failures times in a row, circuit
+// breaker opens and fetching fails fast with CircuitOpenError until probe succeeds.
+//
+// Messages are logged with logger from ctx, if any (see logger.NewContext).
+func (f *Fetch) Metatile(ctx context.Context, mt metatile.Metatile, src config.Source) (metatile.Data, error) {
 	var data metatile.Data
+
+	l := logger.FromContext(ctx, f.logger)
+	key := mt.Filepath("")
+	if err := f.checkNegative(ctx, key); err != nil {
+		return data, err
+	}
+
+	if err := f.breakers.allow(src); err != nil {
+		return data, err
+	}
+
+	failPolicy := src.Partial.Policy == "" || src.Partial.Policy == config.PartialFail
+	stopOnMiss := failPolicy && !src.FailoverNotFound
+
+	var missing []tileMiss
 	xybox := mt.XYBox()
 	for _, x := range xybox.X {
 		for _, y := range xybox.Y {
-			offset := metatile.XYOffset(x, y)
-			url := strings.Replace(URLTmpl, "{z}", strconv.Itoa(mt.Zoom), 1)
-			url = strings.Replace(url, "{x}", strconv.Itoa(x), 1)
-			url = strings.Replace(url, "{y}", strconv.Itoa(y), 1)
+			missing = append(missing, tileMiss{x: x, y: y})
+		}
+	}
+	total := len(missing)
+
+	var err error
+	var ok bool
+	var supplied []string
+	for _, url := range f.upstreams.order(src.Upstreams()) {
+		var left []tileMiss
+		left, err = f.metatileFrom(&data, mt.Zoom, missing, url, src, stopOnMiss)
+		if err != nil {
+			l.Warn("Fetch/Metatile: upstream failed", "metatile", key, "upstream", url, "error", err)
+			f.upstreams.failure(url, err)
+			continue
+		}
 
-			res, err := httpclient.Get(url, f.cfg.UserAgent)
-			if err != nil {
-				return data, err
+		f.upstreams.success(url)
+		ok = true
+		if len(left) < len(missing) {
+			supplied = append(supplied, url)
+		}
+		missing = left
+		if len(missing) == 0 || stopOnMiss || !src.FailoverNotFound {
+			break
+		}
+	}
+
+	if !ok {
+		f.breakers.failure(src)
+		err = fmt.Errorf("Fetch/Metatile: all upstreams failed: %v", err)
+		f.addNegative(key, src, err)
+		return data, err
+	}
+
+	f.breakers.success(src)
+
+	if len(missing) > 0 {
+		if failPolicy {
+			f.addNegative(key, src, missing[0].err)
+			return data, missing[0].err
+		}
+
+		notFound := 0
+		for _, m := range missing {
+			if httpclient.IsNotFound(m.err) {
+				notFound++
 			}
-			data[offset] = res
+		}
+
+		if len(missing) == total && notFound < len(missing) {
+			err = fmt.Errorf("Fetch/Metatile: all tiles failed: %v", missing[0].err)
+			f.addNegative(key, src, err)
+			return data, err
+		}
+
+		for _, m := range missing {
+			l.Warn("Fetch/Metatile: tile is missing", "metatile", key, "policy", src.Partial.Policy, "error", m.err)
+			data[metatile.XYOffset(m.x, m.y)] = src.Partial.Blank
 		}
 	}
+
+	l.Info("Fetch/Metatile: fetched", "metatile", key, "upstreams", strings.Join(supplied, ","))
+
 	// debug slow connections
 	// time.Sleep(time.Second * 10)
 	return data, nil
 }
 
-// MetatileWaitWriteToCache fetchs metatile data and writes it to cache. If metatile already in the
-// fetching queue, wait for fetching and writing complete.
-func (f *Fetch) MetatileWaitWriteToCache(mt metatile.Metatile, URLTmpl string, w cache.Writer) error {
-	key := mt.Filepath("")
-
-	if f.queue.HasKey(key) {
-		f.logger.Printf("[DEBUG] already in queue, wait: %v", key)
-		if errw := f.queue.Wait(key, f.cfg.QueueTimeout); errw != nil {
-			return errw
-		}
-		return nil
-	}
+// tileMiss contains coordinates of tile inside metatile and error of the last fetching attempt.
+type tileMiss struct {
+	x, y int
+	err  error
+}
 
-	f.logger.Printf("[DEBUG] add to queue: %v", key)
-	f.queue.Add(key)
-	defer func() {
-		f.logger.Printf("done, del from queue: %v", key)
-		f.queue.Del(key)
-	}()
+// metatileFrom fetchs tiles from upstream url to data. Returns tiles not found or invalid. If
+// stopOnMiss is set, returns after the first missing tile. Returns error if upstream fails.
+func (f *Fetch) metatileFrom(data *metatile.Data, zoom int, tiles []tileMiss, url string, src config.Source, stopOnMiss bool) ([]tileMiss, error) {
+	var missing []tileMiss
+	for _, t := range tiles {
+		res, err := f.get(tileURL(url, zoom, t.x, t.y), zoom, src)
+		if err != nil {
+			if !httpclient.IsNotFound(err) && !isInvalid(err) {
+				return nil, err
+			}
 
-	data, err := f.Metatile(mt, URLTmpl)
-	if err != nil {
-		return err
-	}
+			t.err = err
+			missing = append(missing, t)
+			if stopOnMiss {
+				return missing, nil
+			}
+			continue
+		}
 
-	err = w.Write(mt, data)
-	if err != nil {
-		return err
+		data[metatile.XYOffset(t.x, t.y)] = res
 	}
 
-	return nil
+	return missing, nil
 }
 
-// MetatileWriteToCache fetchs metatile data and writes it to cache. If metatile already in the
-// fetching queue, return error ErrQueueHasKey.
-func (f *Fetch) MetatileWriteToCache(mt metatile.Metatile, URLTmpl string, w cache.Writer) error {
+// Start starts or joins flight, which fetchs metatile data and writes it to cache. Returns flight
+// and true if new fetching was started. Flight result is metatile.Data.
+//
+// Fetching runs in the scheduler with given priority, flight fails with ErrQueueFull if queue of
+// this priority is saturated. If joined fetching has lower priority and still waits in the queue,
+// it is moved to the queue with given priority.
+//
+// Fetching and writing are logged with logger from ctx of the caller, who started the flight.
+// Cancelling ctx does not stop fetching.
+func (f *Fetch) Start(ctx context.Context, mt metatile.Metatile, src config.Source, w cache.Writer, prio Priority) (*queue.Flight, bool) {
+	l := logger.FromContext(ctx, f.logger)
 	key := mt.Filepath("")
 
-	if f.queue.HasKey(key) {
-		f.logger.Printf("[DEBUG] already in queue, wait: %v", key)
-		return ErrQueueHasKey
-	}
+	fl, leader := f.queue.Start(key, func() (interface{}, error) {
+		defer l.Debug("Fetch: done, del from queue", "metatile", key)
+		ctx := logger.NewContext(context.Background(), l)
 
-	f.logger.Printf("[DEBUG] add to queue: %v", key)
-	f.queue.Add(key)
-	defer func() {
-		f.logger.Printf("done, del from queue: %v", key)
-		f.queue.Del(key)
-	}()
+		type result struct {
+			data metatile.Data
+			err  error
+		}
 
-	data, err := f.Metatile(mt, URLTmpl)
-	if err != nil {
-		return err
+		done := make(chan result, 1)
+		err := f.scheduler.submit(key, src.Name, prio, func(err error) {
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+
+			data, err := f.Metatile(ctx, mt, src)
+			if err == nil {
+				err = w.Write(ctx, mt, data)
+			}
+			done <- result{data, err}
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		r := <-done
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		return r.data, nil
+	})
+
+	if leader {
+		l.Debug("Fetch: add to queue", "metatile", key, "priority", prio)
+	} else {
+		l.Debug("Fetch: already in queue", "metatile", key, "priority", prio)
+		f.scheduler.promote(key, prio)
 	}
 
-	err = w.Write(mt, data)
+	return fl, leader
+}
+
+// MetatileWait fetchs metatile data with interactive priority, writes it to cache and returns data.
+// If metatile already in the fetching queue, wait for fetching and writing complete and return its
+// result. Waiting is limited by ctx and cfg.QueueTimeout, fetching continues for other waiters after
+// that.
+func (f *Fetch) MetatileWait(ctx context.Context, mt metatile.Metatile, src config.Source, w cache.Writer) (metatile.Data, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(f.cfg.QueueTimeout)*time.Second)
+	defer cancel()
+
+	fl, _ := f.Start(ctx, mt, src, w, PriorityInteractive)
+	v, err := fl.Wait(ctx)
+	if err == context.DeadlineExceeded {
+		return metatile.Data{}, queue.ErrWaitTimeout
+	}
 	if err != nil {
-		return err
+		return metatile.Data{}, err
 	}
 
-	return nil
+	return v.(metatile.Data), nil
+}
+
+// MetatileWaitWriteToCache fetchs metatile data and writes it to cache. If metatile already in the
+// fetching queue, wait for fetching and writing complete and return its error.
+func (f *Fetch) MetatileWaitWriteToCache(ctx context.Context, mt metatile.Metatile, src config.Source, w cache.Writer) error {
+	_, err := f.MetatileWait(ctx, mt, src, w)
+	return err
 }
@@ -0,0 +1,119 @@
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// testUpstream serves tiles /{mode}/{z}/{x}/{y}. Mode is one of:
+//
+//	ok       - all tiles are found
+//	missing  - tile 0/0 is not found, others are found
+//	notfound - all tiles are not found
+//	invalid  - tiles with x = 0 are invalid (too small), others are not found
+//	large    - tiles with x = 0 are invalid (too large), others are found
+//	error    - server error for all tiles
+func testUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 4 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		x, _ := strconv.Atoi(parts[2])
+		y, _ := strconv.Atoi(parts[3])
+
+		switch mode := parts[0]; {
+		case mode == "ok", mode == "missing" && (x != 0 || y != 0):
+			w.Write([]byte("tile"))
+		case mode == "invalid" && x == 0:
+			w.Write([]byte("x"))
+		case mode == "large":
+			if x == 0 {
+				w.Write(make([]byte, 1<<20))
+				return
+			}
+			w.Write([]byte("tile"))
+		case mode == "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMetatile(t *testing.T) {
+	srv := testUpstream()
+	defer srv.Close()
+	url := func(mode string) string { return srv.URL + "/" + mode + "/{z}/{x}/{y}" }
+
+	tests := []struct {
+		name     string
+		upstream []string
+		policy   string
+		failover bool
+		// expected data of tiles 0/0 and 1/1, if err is not expected
+		tile00, tile11 string
+		err            bool
+	}{
+		{name: "all found", upstream: []string{"ok"}, tile00: "tile", tile11: "tile"},
+		{name: "fail on missing", upstream: []string{"missing"}, err: true},
+		{name: "empty on missing", upstream: []string{"missing"}, policy: config.PartialEmpty, tile00: "", tile11: "tile"},
+		{name: "blank on missing", upstream: []string{"missing"}, policy: config.PartialBlank, tile00: "blank", tile11: "tile"},
+		{name: "all not found", upstream: []string{"notfound"}, policy: config.PartialEmpty, tile00: "", tile11: ""},
+		{name: "empty on too large", upstream: []string{"large"}, policy: config.PartialEmpty, tile00: "", tile11: "tile"},
+		{name: "all failed, not all not found", upstream: []string{"invalid"}, policy: config.PartialBlank, err: true},
+		{name: "upstream error", upstream: []string{"error"}, policy: config.PartialEmpty, err: true},
+		{name: "failover on error", upstream: []string{"error", "ok"}, tile00: "tile", tile11: "tile"},
+		{name: "no failover on missing", upstream: []string{"missing", "ok"}, err: true},
+		{name: "failover on missing", upstream: []string{"missing", "ok"}, failover: true, tile00: "tile", tile11: "tile"},
+	}
+
+	mt := metatile.NewFromTile(tile.Tile{Map: "style", Zoom: 10, X: 0, Y: 0})
+	for _, tt := range tests {
+		f := New(config.Fetch{}, logger.New(ioutil.Discard, logger.Options{}))
+		src := config.Source{
+			Name:             "style",
+			URL:              url(tt.upstream[0]),
+			FailoverNotFound: tt.failover,
+			Validate:         config.Validate{MinSize: 2, MaxSize: 16},
+			Partial:          config.Partial{Policy: tt.policy},
+		}
+		if tt.policy == config.PartialBlank {
+			src.Partial.Blank = []byte("blank")
+		}
+		for _, u := range tt.upstream[1:] {
+			src.URLs = append(src.URLs, url(u))
+		}
+
+		data, err := f.Metatile(context.Background(), mt, src)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%v: expected error, got nil", tt.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.name, err)
+			continue
+		}
+
+		if s := string(data[metatile.XYOffset(0, 0)]); s != tt.tile00 {
+			t.Errorf("%v: expected tile 0/0 %q, got %q", tt.name, tt.tile00, s)
+		}
+		if s := string(data[metatile.XYOffset(1, 1)]); s != tt.tile11 {
+			t.Errorf("%v: expected tile 1/1 %q, got %q", tt.name, tt.tile11, s)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package fetch
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/httpclient"
+	"github.com/tierpod/metatiles-cacher/pkg/metrics"
+)
+
+var (
+	upstreamRequests = metrics.NewCounter("metatiles_upstream_requests_total",
+		"Count of tile requests to remote sources by result: ok, not_found, invalid, error.", "source", "zoom", "result")
+	upstreamDuration = metrics.NewHistogram("metatiles_upstream_request_duration_seconds",
+		"Duration of tile requests to remote sources.", metrics.DefaultBuckets, "source", "zoom")
+	queueWait = metrics.NewHistogram("metatiles_queue_wait_seconds",
+		"Time metatiles wait in the fetching queue for free worker.", metrics.DefaultBuckets, "source", "priority")
+)
+
+// observeUpstream updates metrics of tile request to remote source, started at start.
+func observeUpstream(source string, zoom int, start time.Time, err error) {
+	z := strconv.Itoa(zoom)
+	upstreamDuration.Observe(time.Since(start).Seconds(), source, z)
+
+	result := "ok"
+	switch {
+	case err == nil:
+	case httpclient.IsNotFound(err):
+		result = "not_found"
+	case isInvalid(err):
+		result = "invalid"
+	default:
+		result = "error"
+	}
+	upstreamRequests.Inc(source, z, result)
+}
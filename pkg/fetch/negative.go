@@ -0,0 +1,80 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/httpclient"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/negcache"
+)
+
+// negativeInterval is the interval between purging expired entries of negative cache and saving it
+// to file.
+const negativeInterval = time.Minute
+
+// NegativeError is the error returned if tile or metatile is found in the negative cache.
+type NegativeError struct {
+	Key   string
+	Entry negcache.Entry
+}
+
+func (e NegativeError) Error() string {
+	return fmt.Sprintf("negative cache: %v: %v", e.Key, e.Entry.Reason)
+}
+
+// IsNotFound returns true if err means that tile or metatile was not found on remote source.
+func IsNotFound(err error) bool {
+	if e, ok := err.(NegativeError); ok {
+		return e.Entry.NotFound
+	}
+
+	return httpclient.IsNotFound(err)
+}
+
+// checkNegative returns NegativeError if key is found in the negative cache.
+func (f *Fetch) checkNegative(ctx context.Context, key string) error {
+	e, found := f.negative.Get(key)
+	if !found {
+		return nil
+	}
+
+	logger.FromContext(ctx, f.logger).Debug("Fetch: found in negative cache", "key", key)
+	return NegativeError{Key: key, Entry: e}
+}
+
+// addNegative adds key to the negative cache with ttl from src configuration.
+func (f *Fetch) addNegative(key string, src config.Source, err error) {
+	e := negcache.Entry{Reason: err.Error(), NotFound: httpclient.IsNotFound(err)}
+	ttl := src.Negative.ErrorTTL
+	if e.NotFound {
+		ttl = src.Negative.TTL
+	}
+
+	f.negative.Add(key, e, time.Duration(ttl)*time.Second)
+}
+
+// SaveNegative saves negative cache to cfg.NegativeCacheFile, if it is set.
+func (f *Fetch) SaveNegative() error {
+	if f.cfg.NegativeCacheFile == "" {
+		return nil
+	}
+
+	return f.negative.Save(f.cfg.NegativeCacheFile)
+}
+
+// negativeLoop periodically purges expired entries of negative cache, so entries of keys never
+// requested again do not pile up, and saves it to file, if it is set.
+func (f *Fetch) negativeLoop() {
+	for range time.Tick(negativeInterval) {
+		if n := f.negative.Purge(); n > 0 {
+			f.logger.Debug("Fetch: negative cache purged", "entries", n)
+		}
+
+		if err := f.SaveNegative(); err != nil {
+			f.logger.Error("Fetch: save negative cache", "error", err)
+		}
+	}
+}
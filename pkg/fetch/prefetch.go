@@ -0,0 +1,154 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// Prefetcher provides interface for prefetching metatiles around given metatile.
+type Prefetcher interface {
+	Prefetch(ctx context.Context, mt metatile.Metatile, src config.Source, c cache.ReadWriter) int
+}
+
+// Prefetch starts fetching of metatiles around mt with background priority and writing them to
+// cache, according to src.Prefetch configuration. Skips metatiles out of source zoom levels and
+// metatiles found in cache. Count of prefetched metatiles is limited by src.Prefetch.Budget per
+// minute, metatiles already fetching are not charged. Does not wait for fetching. Returns count of
+// started metatiles.
+func (f *Fetch) Prefetch(ctx context.Context, mt metatile.Metatile, src config.Source, c cache.ReadWriter) int {
+	if !src.Prefetch.Enabled() {
+		return 0
+	}
+
+	l := logger.FromContext(ctx, f.logger)
+
+	started := 0
+	for _, p := range prefetchCandidates(mt, src) {
+		if found, _ := c.Check(ctx, tile.Tile{Map: p.Map, Zoom: p.Zoom, X: p.X, Y: p.Y}); found {
+			continue
+		}
+
+		if f.checkNegative(ctx, p.Filepath("")) != nil {
+			continue
+		}
+
+		if !f.prefetch.take(src.Name, src.Prefetch.Budget) {
+			l.Debug("Fetch/Prefetch: budget is exhausted", "source", src.Name)
+			break
+		}
+
+		if _, leader := f.Start(ctx, p, src, c, PriorityBackground); !leader {
+			// joined running fetching does not request upstream
+			f.prefetch.refund(src.Name, src.Prefetch.Budget)
+			continue
+		}
+		l.Debug("Fetch/Prefetch: started", "metatile", p)
+		started++
+	}
+
+	return started
+}
+
+// prefetchCandidates returns neighbour metatiles of mt on the same zoom level, child metatiles on
+// the next zoom level and parent metatile on the previous one, within source zoom levels.
+func prefetchCandidates(mt metatile.Metatile, src config.Source) []metatile.Metatile {
+	var result []metatile.Metatile
+	add := func(z, x, y int) {
+		n := 1 << uint(z)
+		if z < 0 || x < 0 || y < 0 || x >= n || y >= n {
+			return
+		}
+
+		min, max := src.ZoomRange(latlong.New(z, x, y))
+		if z < min || z > max {
+			return
+		}
+
+		p := metatile.NewFromTile(tile.Tile{Map: mt.Map, Zoom: z, X: x, Y: y})
+		if p.X == mt.X && p.Y == mt.Y && p.Zoom == mt.Zoom {
+			return
+		}
+		result = append(result, p)
+	}
+
+	size := metatile.MaxSize
+	if src.Prefetch.Neighbours {
+		for _, dy := range []int{-size, 0, size} {
+			for _, dx := range []int{-size, 0, size} {
+				add(mt.Zoom, mt.X+dx, mt.Y+dy)
+			}
+		}
+	}
+
+	if src.Prefetch.Zoom {
+		for _, dy := range []int{0, size} {
+			for _, dx := range []int{0, size} {
+				add(mt.Zoom+1, mt.X*2+dx, mt.Y*2+dy)
+			}
+		}
+		add(mt.Zoom-1, mt.X/2, mt.Y/2)
+	}
+
+	return result
+}
+
+// budgets limits count of prefetched metatiles per minute for each source.
+type budgets struct {
+	mx     sync.Mutex
+	tokens map[string]float64
+	last   map[string]time.Time
+}
+
+func newBudgets() *budgets {
+	return &budgets{
+		tokens: make(map[string]float64),
+		last:   make(map[string]time.Time),
+	}
+}
+
+// take takes one token from the source budget. Budget is refilled continuously up to limit tokens
+// per minute. Returns false if budget is exhausted.
+func (b *budgets) take(name string, limit int) bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	tokens, found := b.tokens[name]
+	if !found {
+		tokens = float64(limit)
+	} else {
+		tokens += now.Sub(b.last[name]).Minutes() * float64(limit)
+		if tokens > float64(limit) {
+			tokens = float64(limit)
+		}
+	}
+	b.last[name] = now
+
+	if tokens < 1 {
+		b.tokens[name] = tokens
+		return false
+	}
+
+	b.tokens[name] = tokens - 1
+	return true
+}
+
+// refund returns token taken from the source budget, up to limit tokens.
+func (b *budgets) refund(name string, limit int) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if tokens := b.tokens[name] + 1; tokens < float64(limit) {
+		b.tokens[name] = tokens
+	} else {
+		b.tokens[name] = float64(limit)
+	}
+}
@@ -0,0 +1,100 @@
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+func TestPrefetchCandidates(t *testing.T) {
+	src := config.Source{
+		Name:     "style",
+		Zoom:     config.Zoom{Min: 1, Max: 10},
+		Prefetch: config.Prefetch{Neighbours: true, Zoom: true},
+	}
+
+	testData := []struct {
+		z, x, y int
+		count   int
+	}{
+		// 8 neighbours, 4 children, 1 parent
+		{9, 16, 16, 13},
+		// corner: 3 neighbours, 4 children, 1 parent
+		{9, 0, 0, 8},
+		// max zoom: no children
+		{10, 16, 16, 9},
+		// zoom 2 and 3 are single metatiles: 1 child, 1 parent
+		{2, 0, 0, 2},
+	}
+
+	for _, tt := range testData {
+		mt := metatile.NewFromTile(tile.Tile{Map: "style", Zoom: tt.z, X: tt.x, Y: tt.y})
+		result := prefetchCandidates(mt, src)
+		if len(result) != tt.count {
+			t.Errorf("prefetchCandidates(%v/%v/%v): expected %v metatiles, got %v", tt.z, tt.x, tt.y, tt.count, len(result))
+		}
+
+		seen := make(map[string]bool)
+		for _, p := range result {
+			if seen[p.Filepath("")] {
+				t.Errorf("prefetchCandidates(%v/%v/%v): duplicate %v", tt.z, tt.x, tt.y, p)
+			}
+			seen[p.Filepath("")] = true
+		}
+	}
+}
+
+func TestBudgets(t *testing.T) {
+	b := newBudgets()
+	for i := 0; i < 3; i++ {
+		if !b.take("style", 3) {
+			t.Errorf("take: expected token %v", i)
+		}
+	}
+
+	if b.take("style", 3) {
+		t.Errorf("take: expected budget is exhausted")
+	}
+
+	if !b.take("other", 3) {
+		t.Errorf("take: expected separate budget for other source")
+	}
+}
+
+// emptyCache is the cache, which does not contain metatiles.
+type emptyCache struct{}
+
+func (emptyCache) Read(ctx context.Context, t tile.Tile) (tile.Data, error) { return nil, nil }
+func (emptyCache) Check(ctx context.Context, t tile.Tile) (bool, time.Time) {
+	return false, time.Time{}
+}
+func (emptyCache) Write(ctx context.Context, m metatile.Metatile, data metatile.Data) error {
+	return nil
+}
+
+func TestPrefetchBudget(t *testing.T) {
+	// fetcher without workers: metatiles wait in the queue until shutdown
+	f := New(config.Fetch{QueueDepth: 10}, logger.New(ioutil.Discard, logger.Options{}))
+	defer f.Shutdown(context.Background())
+
+	src := config.Source{Name: "style", Zoom: config.Zoom{Min: 1, Max: 18},
+		Prefetch: config.Prefetch{Neighbours: true, Budget: 1}}
+	mt := metatile.NewFromTile(tile.Tile{Map: "style", Zoom: 10, X: 8, Y: 8})
+	candidates := prefetchCandidates(mt, src)
+
+	// the first candidate is already fetching and is not charged
+	f.Start(context.Background(), candidates[0], src, emptyCache{}, PriorityBackground)
+	if n := f.Prefetch(context.Background(), mt, src, emptyCache{}); n != 1 {
+		t.Errorf("Prefetch: expected 1 started metatile, got %v", n)
+	}
+
+	if n := len(f.InFlight()); n != 2 {
+		t.Errorf("InFlight: expected 2 metatiles, got %v", n)
+	}
+}
@@ -0,0 +1,320 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is the error returned if fetching queue is saturated.
+	ErrQueueFull = errors.New("fetching queue is full")
+	// ErrShutdown is the error returned for fetching, which is not started before shutdown.
+	ErrShutdown = errors.New("fetching is shut down")
+)
+
+// Priority is the priority class of fetching. Lower value means higher priority.
+type Priority int
+
+// Priority classes.
+const (
+	// PriorityInteractive is used for tiles requested by users and waited for.
+	PriorityInteractive Priority = iota
+	// PriorityFetch is used for /fetch/ requests.
+	PriorityFetch
+	// PriorityBackground is used for refreshing and prefetching.
+	PriorityBackground
+	// PrioritySeed is used for seeding jobs.
+	PrioritySeed
+
+	numPriorities = iota
+)
+
+var priorityNames = [numPriorities]string{"interactive", "fetch", "background", "seed"}
+
+func (p Priority) String() string {
+	if !p.Valid() {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// Valid returns true if p is one of the priority classes.
+func (p Priority) Valid() bool {
+	return p >= 0 && p < numPriorities
+}
+
+// ParsePriority returns priority class by name.
+func ParsePriority(name string) (Priority, error) {
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+
+	return 0, errors.New("unknown priority: " + name)
+}
+
+// job is the fetching job waiting in the scheduler queue.
+type job struct {
+	key    string
+	source string
+	prio   Priority
+	taken  bool
+	added  time.Time
+	// fn runs the job with nil error, or cancels it with non-nil error.
+	fn func(err error)
+}
+
+// class contains queues of priority class. Each source has its own queue, sources are served in
+// round-robin order.
+type class struct {
+	share   int
+	running int
+	pending int
+	queues  map[string][]*job
+	sources []string
+	next    int
+}
+
+// pop returns next job from source queues in round-robin order. Skips jobs moved to another class.
+func (c *class) pop(prio Priority) *job {
+	for i := 0; i < len(c.sources); i++ {
+		n := (c.next + i) % len(c.sources)
+		src := c.sources[n]
+		for len(c.queues[src]) > 0 {
+			j := c.queues[src][0]
+			c.queues[src] = c.queues[src][1:]
+			if j.taken || j.prio != prio {
+				continue
+			}
+
+			c.next = n + 1
+			return j
+		}
+	}
+
+	return nil
+}
+
+func (c *class) push(j *job) {
+	if _, found := c.queues[j.source]; !found {
+		c.sources = append(c.sources, j.source)
+	}
+	c.queues[j.source] = append(c.queues[j.source], j)
+	c.pending++
+}
+
+// scheduler runs fetching jobs in bounded count of workers. Jobs with higher priority are taken
+// first, each priority class can not use more workers than its share.
+type scheduler struct {
+	mx      sync.Mutex
+	cond    *sync.Cond
+	depth   int
+	classes [numPriorities]*class
+	pending map[string]*job
+	closed  bool
+}
+
+// newScheduler creates scheduler and starts workers. shares contains maximum count of workers for
+// each priority class, depth is the maximum count of pending jobs in each priority class.
+func newScheduler(workers, depth int, shares [numPriorities]int) *scheduler {
+	s := &scheduler{
+		depth:   depth,
+		pending: make(map[string]*job),
+	}
+	s.cond = sync.NewCond(&s.mx)
+
+	for i := range s.classes {
+		s.classes[i] = &class{
+			share:  shares[i],
+			queues: make(map[string][]*job),
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.worker()
+	}
+
+	return s
+}
+
+func (s *scheduler) worker() {
+	for {
+		s.mx.Lock()
+		j, c := s.take()
+		for j == nil {
+			s.cond.Wait()
+			j, c = s.take()
+		}
+		s.mx.Unlock()
+
+		queueWait.Observe(time.Since(j.added).Seconds(), j.source, j.prio.String())
+		j.fn(nil)
+
+		s.mx.Lock()
+		c.running--
+		s.cond.Broadcast()
+		s.mx.Unlock()
+	}
+}
+
+// take returns job with the highest priority, which class has free share. Must be called with
+// locked mutex.
+func (s *scheduler) take() (*job, *class) {
+	for prio, c := range s.classes {
+		if c.pending == 0 || c.running >= c.share {
+			continue
+		}
+
+		j := c.pop(Priority(prio))
+		if j == nil {
+			continue
+		}
+
+		j.taken = true
+		c.pending--
+		c.running++
+		delete(s.pending, j.key)
+		return j, c
+	}
+
+	return nil, nil
+}
+
+// submit adds fn with key to the queue of given priority and source. fn is called with nil error by
+// worker, or with ErrShutdown if scheduler is shut down before. Returns ErrQueueFull if queue of
+// priority class is saturated, ErrShutdown if scheduler is shut down.
+func (s *scheduler) submit(key, source string, prio Priority, fn func(err error)) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.closed {
+		return ErrShutdown
+	}
+
+	c := s.classes[prio]
+	if c.pending >= s.depth {
+		return ErrQueueFull
+	}
+
+	j := &job{key: key, source: source, prio: prio, added: time.Now(), fn: fn}
+	c.push(j)
+	s.pending[key] = j
+	s.cond.Signal()
+	return nil
+}
+
+// promote moves pending job with key to the queue of higher priority prio. Does nothing if job is
+// already running or has the same or higher priority.
+func (s *scheduler) promote(key string, prio Priority) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	j, found := s.pending[key]
+	if !found || j.prio <= prio {
+		return
+	}
+
+	s.classes[j.prio].pending--
+	j.prio = prio
+	s.classes[prio].push(j)
+	s.cond.Broadcast()
+}
+
+// shutdown rejects new jobs, cancels pending jobs with ErrShutdown and waits for running jobs until
+// ctx is done.
+func (s *scheduler) shutdown(ctx context.Context) error {
+	s.mx.Lock()
+	s.closed = true
+	var cancelled []*job
+	for _, j := range s.pending {
+		j.taken = true
+		s.classes[j.prio].pending--
+		cancelled = append(cancelled, j)
+	}
+	s.pending = make(map[string]*job)
+	for _, c := range s.classes {
+		c.queues = make(map[string][]*job)
+		c.sources = nil
+		c.next = 0
+	}
+	s.mx.Unlock()
+
+	for _, j := range cancelled {
+		j.fn(ErrShutdown)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.mx.Lock()
+		for s.running() > 0 {
+			s.cond.Wait()
+		}
+		s.mx.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running returns count of running jobs. Must be called with locked mutex.
+func (s *scheduler) running() int {
+	n := 0
+	for _, c := range s.classes {
+		n += c.running
+	}
+	return n
+}
+
+// QueueStat contains count of pending and running jobs of priority class.
+type QueueStat struct {
+	Priority string `json:"priority"`
+	Pending  int    `json:"pending"`
+	Running  int    `json:"running"`
+	Share    int    `json:"share"`
+}
+
+// stats returns queue statistics for each priority class.
+func (s *scheduler) stats() []QueueStat {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	result := make([]QueueStat, 0, numPriorities)
+	for prio, c := range s.classes {
+		result = append(result, QueueStat{
+			Priority: Priority(prio).String(),
+			Pending:  c.pending,
+			Running:  c.running,
+			Share:    c.share,
+		})
+	}
+
+	return result
+}
+
+// pendingPriority returns priority of pending job with key. Returns false if job is not pending.
+func (s *scheduler) pendingPriority(key string) (Priority, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	j, found := s.pending[key]
+	if !found {
+		return 0, false
+	}
+
+	return j.prio, true
+}
+
+// len returns count of pending jobs.
+func (s *scheduler) len() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return len(s.pending)
+}
@@ -0,0 +1,111 @@
+package fetch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSubmit(t *testing.T) {
+	// scheduler without workers: jobs are never taken from the queue
+	s := newScheduler(0, 2, [numPriorities]int{1, 1, 1, 1})
+	for _, key := range []string{"key1", "key2"} {
+		if err := s.submit(key, "src", PriorityInteractive, func(error) {}); err != nil {
+			t.Errorf("submit: expected nil, got %v", err)
+		}
+	}
+
+	if err := s.submit("key3", "src", PriorityInteractive, func(error) {}); err != ErrQueueFull {
+		t.Errorf("submit: expected ErrQueueFull, got %v", err)
+	}
+
+	// each priority class has its own queue
+	if err := s.submit("key3", "src", PrioritySeed, func(error) {}); err != nil {
+		t.Errorf("submit: expected nil, got %v", err)
+	}
+
+	if s.len() != 3 {
+		t.Errorf("len: expected 3, got %v", s.len())
+	}
+}
+
+func TestSchedulerTake(t *testing.T) {
+	s := newScheduler(0, 10, [numPriorities]int{2, 1, 1, 1})
+
+	submit := func(key, source string, prio Priority) {
+		if err := s.submit(key, source, prio, func(error) {}); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	submit("seed1", "src1", PrioritySeed)
+	submit("bg1", "src1", PriorityBackground)
+	submit("bg2", "src1", PriorityBackground)
+	submit("int1", "src1", PriorityInteractive)
+	submit("int2", "src1", PriorityInteractive)
+	submit("int3", "src2", PriorityInteractive)
+	// user requests metatile queued for prefetching
+	s.promote("bg2", PriorityInteractive)
+
+	var keys []string
+	s.mx.Lock()
+	for j, _ := s.take(); j != nil; j, _ = s.take() {
+		keys = append(keys, j.key)
+	}
+	s.mx.Unlock()
+
+	// interactive share is 2, sources are served in round-robin order, background share is 1
+	expected := []string{"int1", "int3", "bg1", "seed1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("take: expected %v, got %v", expected, keys)
+	}
+
+	stats := s.stats()
+	if stats[0].Pending != 2 || stats[0].Running != 2 || stats[2].Pending != 0 {
+		t.Errorf("stats: unexpected result %+v", stats)
+	}
+}
+
+func TestSchedulerShutdown(t *testing.T) {
+	s := newScheduler(1, 10, [numPriorities]int{1, 1, 1, 1})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := s.submit("running", "src", PriorityInteractive, func(error) {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	<-started
+
+	cancelled := make(chan error, 1)
+	if err := s.submit("pending", "src", PriorityInteractive, func(err error) { cancelled <- err }); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	// running job is not finished before deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("shutdown: expected DeadlineExceeded, got %v", err)
+	}
+
+	if err := <-cancelled; err != ErrShutdown {
+		t.Errorf("pending job: expected ErrShutdown, got %v", err)
+	}
+
+	if err := s.submit("new", "src", PriorityInteractive, func(error) {}); err != ErrShutdown {
+		t.Errorf("submit: expected ErrShutdown, got %v", err)
+	}
+
+	close(release)
+	if err := s.shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: expected nil, got %v", err)
+	}
+
+	if s.len() != 0 {
+		t.Errorf("len: expected 0, got %v", s.len())
+	}
+}
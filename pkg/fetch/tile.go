@@ -1,27 +1,95 @@
 package fetch
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/tierpod/metatiles-cacher/pkg/config"
 	"github.com/tierpod/metatiles-cacher/pkg/httpclient"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 	"github.com/tierpod/metatiles-cacher/pkg/tile"
+	"github.com/tierpod/metatiles-cacher/pkg/validate"
 )
 
-// Tile fetchs tile data, using URLTmpl as URL template with placeholders: {x} {y} {z}.
-func (f *Fetch) Tile(t tile.Tile, URLTmpl string) (tile.Data, error) {
-	url := strings.Replace(URLTmpl, "{z}", strconv.Itoa(t.Zoom), 1)
-	url = strings.Replace(url, "{x}", strconv.Itoa(t.X), 1)
-	url = strings.Replace(url, "{y}", strconv.Itoa(t.Y), 1)
+// Tile fetchs tile data from src upstreams, using URL templates with placeholders: {x} {y} {z}.
+// Failed tiles are stored in the negative cache with ttl from src.Negative.
+func (f *Fetch) Tile(ctx context.Context, t tile.Tile, src config.Source) (tile.Data, error) {
+	l := logger.FromContext(ctx, f.logger)
+	key := t.Filepath("")
+	if err := f.checkNegative(ctx, key); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for _, tmpl := range f.upstreams.order(src.Upstreams()) {
+		url := tileURL(tmpl, t.Zoom, t.X, t.Y)
+		l.Info("Fetch/Tile: get", "url", url)
+
+		var data tile.Data
+		data, err = f.get(url, t.Zoom, src)
+		if err == nil {
+			return data, nil
+		}
+
+		l.Error("Fetch/Tile: get failed", "url", url, "error", err)
+		if (httpclient.IsNotFound(err) || isInvalid(err)) && !src.FailoverNotFound {
+			break
+		}
+	}
+
+	f.addNegative(key, src, err)
+	return nil, err
+}
+
+// InvalidError is the error returned if tile fetched from remote source is not valid.
+type InvalidError struct {
+	URL string
+	Err error
+}
+
+func (e InvalidError) Error() string {
+	return fmt.Sprintf("%v: %v", e.URL, e.Err)
+}
 
-	f.logger.Printf("Fetch/Tile: get from URL(%v)", url)
+func isInvalid(err error) bool {
+	_, ok := err.(InvalidError)
+	return ok
+}
+
+// get gets tile data of zoom level by url and validates it with src rules.
+func (f *Fetch) get(url string, zoom int, src config.Source) (data tile.Data, err error) {
+	defer func(start time.Time) { observeUpstream(src.Name, zoom, start, err) }(time.Now())
 
-	data, err := httpclient.Get(url, f.cfg.UserAgent)
+	res, err := httpclient.Get(url, f.cfg.UserAgent, time.Duration(f.cfg.RequestTimeout)*time.Second, src.Validate.MaxSize)
+	if _, ok := err.(httpclient.SizeError); ok {
+		return nil, InvalidError{URL: url, Err: err}
+	}
 	if err != nil {
-		f.logger.Printf("[ERROR] Fetch/Tile: %v", err)
-		return nil, fmt.Errorf("Fetch/Tile: %v", err)
+		return nil, err
 	}
 
-	return data, nil
+	if err := validate.ContentType(res.ContentType, src.Validate.ContentType); err != nil {
+		return nil, InvalidError{URL: url, Err: err}
+	}
+
+	if err := validate.Size(len(res.Data), src.Validate.MinSize, src.Validate.MaxSize); err != nil {
+		return nil, InvalidError{URL: url, Err: err}
+	}
+
+	if err := validate.Format(src.Ext, res.Data); err != nil {
+		return nil, InvalidError{URL: url, Err: err}
+	}
+
+	return res.Data, nil
+}
+
+// tileURL replaces placeholders {z} {x} {y} in URL template.
+func tileURL(tmpl string, z, x, y int) string {
+	url := strings.Replace(tmpl, "{z}", strconv.Itoa(z), 1)
+	url = strings.Replace(url, "{x}", strconv.Itoa(x), 1)
+	url = strings.Replace(url, "{y}", strconv.Itoa(y), 1)
+	return url
 }
@@ -0,0 +1,162 @@
+package fetch
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/httpclient"
+)
+
+const (
+	// upstreamFailures is the count of consecutive failures after which upstream is marked as down.
+	upstreamFailures = 3
+	// upstreamRetry is the initial time while upstream marked as down is skipped. Doubles after
+	// each next failure, up to upstreamMaxRetry.
+	upstreamRetry    = 10 * time.Second
+	upstreamMaxRetry = 5 * time.Minute
+)
+
+// UpstreamHealth contains health state of remote source URL template.
+type UpstreamHealth struct {
+	URL string `json:"url"`
+	// Count of consecutive failures.
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	Down      bool      `json:"down"`
+	RetryAt   time.Time `json:"retry_at,omitempty"`
+	// Count of metatiles supplied by this upstream.
+	Metatiles int `json:"metatiles"`
+}
+
+// upstreams contains health states of all used upstreams.
+type upstreams struct {
+	mx sync.Mutex
+	m  map[string]*UpstreamHealth
+}
+
+func newUpstreams() *upstreams {
+	return &upstreams{
+		m: make(map[string]*UpstreamHealth),
+	}
+}
+
+func (u *upstreams) get(url string) *UpstreamHealth {
+	h, found := u.m[url]
+	if !found {
+		h = &UpstreamHealth{URL: url}
+		u.m[url] = h
+	}
+	return h
+}
+
+// order returns urls without upstreams marked as down, keeping given order. If all upstreams are
+// down, returns them sorted by retry time.
+func (u *upstreams) order(urls []string) []string {
+	u.mx.Lock()
+	defer u.mx.Unlock()
+
+	now := time.Now()
+	var alive, down []string
+	for _, url := range urls {
+		h := u.get(url)
+		if h.Down && now.Before(h.RetryAt) {
+			down = append(down, url)
+			continue
+		}
+		alive = append(alive, url)
+	}
+
+	if len(alive) > 0 {
+		return alive
+	}
+
+	sort.SliceStable(down, func(i, j int) bool {
+		return u.m[down[i]].RetryAt.Before(u.m[down[j]].RetryAt)
+	})
+	return down
+}
+
+// success resets failures counter of upstream.
+func (u *upstreams) success(url string) {
+	u.mx.Lock()
+	defer u.mx.Unlock()
+
+	h := u.get(url)
+	h.Failures = 0
+	h.Down = false
+	h.RetryAt = time.Time{}
+	h.Metatiles++
+}
+
+// failure increments failures counter of upstream and marks it as down after upstreamFailures.
+func (u *upstreams) failure(url string, err error) {
+	u.mx.Lock()
+	defer u.mx.Unlock()
+
+	h := u.get(url)
+	h.Failures++
+	h.LastError = err.Error()
+	if h.Failures < upstreamFailures {
+		return
+	}
+
+	retry := upstreamRetry << uint(h.Failures-upstreamFailures)
+	if retry > upstreamMaxRetry || retry <= 0 {
+		retry = upstreamMaxRetry
+	}
+	h.Down = true
+	h.RetryAt = time.Now().Add(retry)
+}
+
+// health returns copy of health states, sorted by url.
+func (u *upstreams) health() []UpstreamHealth {
+	u.mx.Lock()
+	defer u.mx.Unlock()
+
+	var result []UpstreamHealth
+	for _, h := range u.m {
+		result = append(result, *h)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].URL < result[j].URL })
+	return result
+}
+
+// SourceUpstreams returns health states of src upstreams in configured order. Upstreams, which are
+// not used yet, are returned with zero state.
+func (f *Fetch) SourceUpstreams(src config.Source) []UpstreamHealth {
+	f.upstreams.mx.Lock()
+	defer f.upstreams.mx.Unlock()
+
+	var result []UpstreamHealth
+	for _, url := range src.Upstreams() {
+		h, found := f.upstreams.m[url]
+		if !found {
+			h = &UpstreamHealth{URL: url}
+		}
+		result = append(result, *h)
+	}
+
+	return result
+}
+
+// Probe checks that at least one of src upstreams is reachable: requests top left tile of minimum
+// zoom level and returns nil on any response except server errors. Health states of upstreams are
+// not changed.
+func (f *Fetch) Probe(src config.Source, timeout time.Duration) error {
+	var err error
+	for _, tmpl := range src.Upstreams() {
+		if err = httpclient.Probe(tileURL(tmpl, src.Zoom.Min, 0, 0), f.cfg.UserAgent, timeout); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Upstreams returns health states of remote sources used by fetcher.
+func (f *Fetch) Upstreams() []UpstreamHealth {
+	return f.upstreams.health()
+}
@@ -0,0 +1,42 @@
+package fetch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUpstreamsOrder(t *testing.T) {
+	u := newUpstreams()
+	urls := []string{"primary", "secondary", "third"}
+
+	if r := u.order(urls); !reflect.DeepEqual(r, urls) {
+		t.Errorf("order: expected %v, got %v", urls, r)
+	}
+
+	for i := 0; i < upstreamFailures; i++ {
+		u.failure("primary", errors.New("connection refused"))
+	}
+
+	expected := []string{"secondary", "third"}
+	if r := u.order(urls); !reflect.DeepEqual(r, expected) {
+		t.Errorf("order: expected %v, got %v", expected, r)
+	}
+
+	// all upstreams are down, use the one which will be retried first
+	for i := 0; i < upstreamFailures; i++ {
+		u.failure("third", errors.New("connection refused"))
+		u.failure("secondary", errors.New("connection refused"))
+	}
+
+	expected = []string{"primary", "third", "secondary"}
+	if r := u.order(urls); !reflect.DeepEqual(r, expected) {
+		t.Errorf("order: expected %v, got %v", expected, r)
+	}
+
+	u.success("primary")
+	expected = []string{"primary"}
+	if r := u.order(urls); !reflect.DeepEqual(r, expected) {
+		t.Errorf("order: expected %v, got %v", expected, r)
+	}
+}
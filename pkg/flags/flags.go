@@ -0,0 +1,80 @@
+// Package flags contains command line flag types for ranges of values.
+package flags
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IntPair is the pair of integers with min and max values. Implements flag.Value interface.
+type IntPair struct {
+	Min, Max int
+}
+
+func (i *IntPair) String() string {
+	return fmt.Sprintf("Int min: %v, max: %v", i.Min, i.Max)
+}
+
+// Set parses value with two integers, separated by '-'.
+func (i *IntPair) Set(value string) error {
+	values := strings.Split(value, "-")
+	if len(values) != 2 {
+		return errors.New("Wrong int range: need 2 integers, separated by '-'")
+	}
+
+	v1, err := strconv.Atoi(values[0])
+	if err != nil {
+		return err
+	}
+
+	v2, err := strconv.Atoi(values[1])
+	if err != nil {
+		return err
+	}
+
+	if v1 > v2 {
+		i.Min = v2
+		i.Max = v1
+	} else {
+		i.Min = v1
+		i.Max = v2
+	}
+
+	return nil
+}
+
+// Float64Pair is the pair of float64 values with min and max values. Implements flag.Value
+// interface.
+type Float64Pair struct {
+	Min, Max float64
+}
+
+func (f *Float64Pair) String() string {
+	return fmt.Sprintf("Float pair: min: %v, max: %v", f.Min, f.Max)
+}
+
+// Set parses value with two float64 values, separated by '-'.
+func (f *Float64Pair) Set(value string) error {
+	values := strings.Split(value, "-")
+	if len(values) != 2 {
+		return errors.New("Wrong float64 range")
+	}
+
+	v1, err := strconv.ParseFloat(values[0], 64)
+	if err != nil {
+		return err
+	}
+
+	v2, err := strconv.ParseFloat(values[1], 64)
+	if err != nil {
+		return err
+	}
+
+	f.Min = math.Min(v1, v2)
+	f.Max = math.Max(v1, v2)
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package flags
+
+import "fmt"
+
+func ExampleIntPair_Set() {
+	values := []string{"10-12", "12-10", "10", "a-12"}
+	for _, v := range values {
+		var p IntPair
+		if err := p.Set(v); err != nil {
+			fmt.Printf("error: %v\n", err)
+			continue
+		}
+		fmt.Printf("%+v\n", p)
+	}
+
+	// Output:
+	// {Min:10 Max:12}
+	// {Min:10 Max:12}
+	// error: Wrong int range: need 2 integers, separated by '-'
+	// error: strconv.Atoi: parsing "a": invalid syntax
+}
+
+func ExampleFloat64Pair_Set() {
+	values := []string{"55.1-54.9", "1.5"}
+	for _, v := range values {
+		var p Float64Pair
+		if err := p.Set(v); err != nil {
+			fmt.Printf("error: %v\n", err)
+			continue
+		}
+		fmt.Printf("%+v\n", p)
+	}
+
+	// Output:
+	// {Min:54.9 Max:55.1}
+	// error: Wrong float64 range
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/accesslog"
+)
+
+// AccessLog writes access log entry for each request after h is served. If request comes from
+// trusted proxy, client address is taken from X-Forwarded-For header. Request id is taken from
+// RequestIDHeader response header, see RequestID.
+func AccessLog(h http.Handler, l *accesslog.Logger, trusted []*net.IPNet) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := NewStatusWriter(w)
+		h.ServeHTTP(sw, r)
+
+		l.Log(accesslog.Entry{
+			RemoteAddr: ClientIP(r, trusted),
+			Time:       start,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     sw.Status,
+			Bytes:      sw.Bytes,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			Latency:    time.Since(start),
+			Source:     sw.Source,
+			Cache:      sw.Cache,
+			RequestID:  sw.Header().Get(RequestIDHeader),
+		})
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// ClientIP returns client address of request. If request comes from trusted proxy, returns the last
+// address from X-Forwarded-For header, which is not trusted proxy.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrusted(host, trusted) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		host = addr
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+
+	return host
+}
+
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
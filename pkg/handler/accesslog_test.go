@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	testData := []struct {
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		// not trusted remote address: header is ignored
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		// spoofed address before untrusted client is ignored
+		{"10.0.0.1:1234", "203.0.113.1, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+	}
+
+	for _, tt := range testData {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+
+		if result := ClientIP(r, trusted); result != tt.expected {
+			t.Errorf("ClientIP(%v, %q): expected %v, got %v", tt.remote, tt.forwarded, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// BearerToken gets token from "Authorization: Bearer" header and compare it with "t".
+// Returns http.StatusUnauthorized if different.
+func BearerToken(h http.Handler, t string, l logger.Logger) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+t {
+			logger.FromContext(r.Context(), l).Error("Unauthorized request: wrong Authorization header",
+				"remote_addr", r.RemoteAddr, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Wrong Authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// RequestIDHeader is the header with request id.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the maximum length of request id accepted from client.
+const maxRequestIDLength = 64
+
+// RequestID sets request id to RequestIDHeader response header and adds logger with request id in
+// "request_id" field to request context (see logger.FromContext). Request id is taken from
+// RequestIDHeader request header (e.g. set by proxy), or generated if header is not set or invalid.
+func RequestID(h http.Handler, l logger.Logger) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logger.NewContext(r.Context(), l.With("request_id", id))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// validRequestID returns true if id is not empty, not too long and contains only letters, digits,
+// '-', '_' and '.'.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	l := logger.New(&buf, logger.Options{})
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.FromContext(r.Context(), l).Info("served")
+	}), l)
+
+	testData := []struct {
+		header string
+		keep   bool
+	}{
+		{"", false},
+		{"req-1.a_B", true},
+		{"bad id", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range testData {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(RequestIDHeader, tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if tt.keep && id != tt.header {
+			t.Errorf("%q: expected request id from header, got %q", tt.header, id)
+		}
+		if !tt.keep && (id == tt.header || len(id) != 16) {
+			t.Errorf("%q: expected generated request id, got %q", tt.header, id)
+		}
+		if expected := "[INFO] served request_id=" + id + "\n"; buf.String() != expected {
+			t.Errorf("%q: expected log %q, got %q", tt.header, expected, buf.String())
+		}
+	}
+}
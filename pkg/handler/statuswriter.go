@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// StatusWriter is the http.ResponseWriter, which records response status and count of written
+// bytes.
+type StatusWriter struct {
+	http.ResponseWriter
+	// Status is the response status, http.StatusOK if WriteHeader is not called.
+	Status int
+	// Bytes is the count of written body bytes.
+	Bytes int
+	// Source and Cache are set by tile handlers for logging: source name and cache lookup result.
+	Source string
+	Cache  string
+}
+
+// NewStatusWriter creates new StatusWriter for w. If w is StatusWriter already, returns it.
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	if sw, ok := w.(*StatusWriter); ok {
+		return sw
+	}
+
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+// WriteHeader records status and writes it to underlying ResponseWriter.
+func (w *StatusWriter) WriteHeader(status int) {
+	w.Status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes data to underlying ResponseWriter and counts written bytes.
+func (w *StatusWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.Bytes += n
+	return n, err
+}
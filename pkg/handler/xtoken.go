@@ -1,17 +1,26 @@
 package handler
 
 import (
-	"log"
 	"net/http"
+
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
 )
 
 // XToken gets "X-Token" header and compare it with "t".
-// Returns http.StatusForbidden if different.
-func XToken(h http.Handler, t string, logger *log.Logger) http.Handler {
+// Returns http.StatusForbidden if different, or if "t" is empty (token is not configured).
+func XToken(h http.Handler, t string, l logger.Logger) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("X-Token")
+		if t == "" {
+			logger.FromContext(r.Context(), l).Error("Forbidden request: X-Token is not configured",
+				"remote_addr", r.RemoteAddr, "path", r.URL.Path)
+			http.Error(w, "X-Token is not configured", http.StatusForbidden)
+			return
+		}
+
 		if token != t {
-			logger.Printf("[ERROR] Forbidden request: %v -> %v: wrong X-Token header: %q", r.RemoteAddr, r.URL.Path, token)
+			logger.FromContext(r.Context(), l).Error("Forbidden request: wrong X-Token header",
+				"remote_addr", r.RemoteAddr, "path", r.URL.Path, "token", token)
 			http.Error(w, "Wrong X-Token header", http.StatusForbidden)
 			return
 		}
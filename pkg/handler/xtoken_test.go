@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+func TestXToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	l := logger.New(ioutil.Discard, logger.Options{})
+
+	testData := []struct {
+		token  string
+		header string
+		status int
+	}{
+		{"secret", "secret", http.StatusOK},
+		{"secret", "wrong", http.StatusForbidden},
+		{"secret", "", http.StatusForbidden},
+		// token is not configured: requests are refused
+		{"", "", http.StatusForbidden},
+	}
+
+	for _, tt := range testData {
+		r := httptest.NewRequest("POST", "/seed", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Token", tt.header)
+		}
+		w := httptest.NewRecorder()
+		XToken(ok, tt.token, l).ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("token %q, header %q: expected status %v, got %v", tt.token, tt.header, tt.status, w.Code)
+		}
+	}
+}
@@ -3,13 +3,48 @@ package httpclient
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
-// Get gets data by url
-func Get(url, ua string) (data []byte, err error) {
-	client := &http.Client{}
+// Response contains body and headers of the http response.
+type Response struct {
+	Data        []byte
+	ContentType string
+}
+
+// StatusError is the error returned if remote server responds with status code other than 200.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("httpclient/Get: %v: Response status %v", e.URL, e.StatusCode)
+}
+
+// SizeError is the error returned if response body is larger than maximum size.
+type SizeError struct {
+	URL string
+	Max int
+}
+
+func (e SizeError) Error() string {
+	return fmt.Sprintf("httpclient/Get: %v: Response body is larger than %v bytes", e.URL, e.Max)
+}
+
+// IsNotFound returns true if err is StatusError with http.StatusNotFound code.
+func IsNotFound(err error) bool {
+	e, ok := err.(StatusError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Get gets data by url. Request fails if it is not finished in timeout, or with SizeError if
+// response body is larger than max bytes. Zero timeout or max disables the check.
+func Get(url, ua string, timeout time.Duration, max int) (*Response, error) {
+	client := &http.Client{Timeout: timeout}
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -25,12 +60,50 @@ func Get(url, ua string) (data []byte, err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("httpclient/Get: %v: Response status %v", url, resp.StatusCode)
+		return nil, StatusError{URL: url, StatusCode: resp.StatusCode}
 	}
 
-	data, err = ioutil.ReadAll(resp.Body)
+	var body io.Reader = resp.Body
+	if max > 0 {
+		body = io.LimitReader(resp.Body, int64(max)+1)
+	}
+
+	data, err := ioutil.ReadAll(body)
 	if err != nil {
 		return nil, fmt.Errorf("httpclient/Get: %v", err)
 	}
-	return data, nil
+
+	if max > 0 && len(data) > max {
+		return nil, SizeError{URL: url, Max: max}
+	}
+
+	return &Response{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// Probe sends GET request to url and returns error if remote server is not reachable in timeout or
+// responds with server error (5xx). Other responses, including not found, are successful.
+func Probe(url, ua string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("httpclient/Newrequest: %v", err)
+	}
+
+	req.Header.Set("User-Agent", ua)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("httpclient/Probe: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return StatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	return nil
 }
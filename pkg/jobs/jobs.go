@@ -0,0 +1,506 @@
+// Package jobs implements persistent queue of metatile fetching jobs. Each change of job is appended
+// to the log file, so queue survives restarts. Log file is compacted on opening.
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// Job states.
+const (
+	StateQueued  = "queued"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+// compactRecords is the count of log records written after which log file is compacted.
+const compactRecords = 10000
+
+// ErrClosed is the error returned if queue is closed.
+var ErrClosed = errors.New("jobs: queue is closed")
+
+// ErrQueueFull is the error returned if count of queued jobs reaches the limit.
+var ErrQueueFull = errors.New("jobs: queue is full")
+
+// Job is the fetching job for metatile.
+type Job struct {
+	ID string `json:"id"`
+	// Metatile file path, used for deduplication.
+	Key      string    `json:"key"`
+	Source   string    `json:"source"`
+	Zoom     int       `json:"zoom"`
+	X        int       `json:"x"`
+	Y        int       `json:"y"`
+	Priority int       `json:"priority"`
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// New creates new job for metatile mt from source with priority.
+func New(mt metatile.Metatile, source string, priority int) Job {
+	mt.Map = source
+	return Job{
+		Key:      mt.Filepath(""),
+		Source:   source,
+		Zoom:     mt.Zoom,
+		X:        mt.X,
+		Y:        mt.Y,
+		Priority: priority,
+	}
+}
+
+// Metatile returns metatile of job.
+func (j Job) Metatile() metatile.Metatile {
+	return metatile.NewFromTile(tile.Tile{Map: j.Source, Zoom: j.Zoom, X: j.X, Y: j.Y})
+}
+
+// Finished returns true if job is done or failed.
+func (j Job) Finished() bool {
+	return j.State == StateDone || j.State == StateFailed
+}
+
+// Queue is the persistent queue of jobs.
+type Queue struct {
+	mx      sync.Mutex
+	path    string
+	file    *os.File
+	records int
+	history int
+	limit   int
+	closed  bool
+
+	jobs   map[string]*Job
+	keys   map[string]string
+	queued []string
+	done   map[string]chan struct{}
+	errs   map[string]error
+	notify chan struct{}
+	quit   chan struct{}
+}
+
+// Open opens queue stored in log file path, creating it if it does not exist. Jobs running before
+// restart are queued again. Only history last finished jobs are kept. If limit > 0, no more than limit
+// jobs can be queued at once.
+func Open(path string, history, limit int) (*Queue, error) {
+	q := &Queue{
+		path:    path,
+		history: history,
+		limit:   limit,
+		jobs:    make(map[string]*Job),
+		keys:    make(map[string]string),
+		done:    make(map[string]chan struct{}),
+		errs:    make(map[string]error),
+		notify:  make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, fmt.Errorf("jobs/Open: %v", err)
+	}
+
+	var queued []*Job
+	for _, j := range q.jobs {
+		if j.State == StateRunning {
+			j.State = StateQueued
+		}
+
+		if !j.Finished() {
+			queued = append(queued, j)
+			q.keys[j.Key] = j.ID
+			q.done[j.ID] = make(chan struct{})
+		}
+	}
+
+	sort.Slice(queued, func(i, j int) bool { return queued[i].Created.Before(queued[j].Created) })
+	for _, j := range queued {
+		q.queued = append(q.queued, j.ID)
+	}
+
+	q.trim()
+	if err := q.compact(); err != nil {
+		return nil, fmt.Errorf("jobs/Open: %v", err)
+	}
+
+	if len(q.queued) > 0 {
+		q.notify <- struct{}{}
+	}
+
+	return q, nil
+}
+
+// load reads log file. The last record for job id wins.
+func (q *Queue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var j Job
+		if err := json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			// skip partially written record
+			continue
+		}
+		q.jobs[j.ID] = &j
+	}
+
+	return scanner.Err()
+}
+
+// compact rewrites log file with current jobs only and opens it for appending. If compaction
+// fails, previous log file is kept open.
+func (q *Queue) compact() error {
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, j := range q.sorted() {
+		data, _ := json.Marshal(j)
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = os.Rename(tmp, q.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	if q.file != nil {
+		q.file.Close()
+	}
+	q.file = file
+	q.records = len(q.jobs)
+	return nil
+}
+
+// write appends job record to log file. Must be called with locked mutex.
+func (q *Queue) write(j *Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if _, err = q.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("jobs: %v", err)
+	}
+
+	q.records++
+	if q.records > compactRecords && q.records > 2*len(q.jobs) {
+		// record is already written, failed compaction is retried on the next write
+		q.compact()
+	}
+
+	return nil
+}
+
+// trim deletes the oldest finished jobs, keeping only q.history of them. Must be called with locked
+// mutex.
+func (q *Queue) trim() {
+	var finished []*Job
+	for _, j := range q.jobs {
+		if j.Finished() {
+			finished = append(finished, j)
+		}
+	}
+
+	if len(finished) <= q.history {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Updated.After(finished[j].Updated) })
+	for _, j := range finished[q.history:] {
+		delete(q.jobs, j.ID)
+		delete(q.errs, j.ID)
+	}
+}
+
+// sorted returns jobs sorted by creation time. Must be called with locked mutex.
+func (q *Queue) sorted() []Job {
+	result := make([]Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		result = append(result, *j)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Created.Before(result[j].Created) })
+	return result
+}
+
+// Add adds job to the queue and returns it with generated ID and true. If job with the same key is
+// already queued or running, returns existing job and false. Returns ErrQueueFull if count of queued
+// jobs reaches the limit.
+func (q *Queue) Add(j Job) (Job, bool, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.closed {
+		return Job{}, false, ErrClosed
+	}
+
+	if id, found := q.keys[j.Key]; found {
+		return *q.jobs[id], false, nil
+	}
+
+	if q.limit > 0 && len(q.queued) >= q.limit {
+		return Job{}, false, ErrQueueFull
+	}
+
+	now := time.Now()
+	j.ID = newID()
+	j.State = StateQueued
+	j.Error = ""
+	j.Created = now
+	j.Updated = now
+
+	// job must be in the queue before writing, because write may compact log file with current jobs
+	q.jobs[j.ID] = &j
+	q.keys[j.Key] = j.ID
+	q.queued = append(q.queued, j.ID)
+	q.done[j.ID] = make(chan struct{})
+
+	if err := q.write(&j); err != nil {
+		delete(q.jobs, j.ID)
+		delete(q.keys, j.Key)
+		delete(q.done, j.ID)
+		q.queued = q.queued[:len(q.queued)-1]
+		return Job{}, false, err
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return j, true, nil
+}
+
+// Next waits for queued job, marks it as running and returns it. Jobs with higher priority (lower
+// value) are returned first.
+func (q *Queue) Next(ctx context.Context) (Job, error) {
+	for {
+		q.mx.Lock()
+		if q.closed {
+			q.mx.Unlock()
+			return Job{}, ErrClosed
+		}
+
+		if len(q.queued) > 0 {
+			j, err := q.take()
+			more := len(q.queued) > 0
+			q.mx.Unlock()
+			if more {
+				// wake up other waiting workers
+				select {
+				case q.notify <- struct{}{}:
+				default:
+				}
+			}
+			return j, err
+		}
+		q.mx.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-q.quit:
+			return Job{}, ErrClosed
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+}
+
+// take removes job with the highest priority from queued list and marks it as running. Must be
+// called with locked mutex.
+func (q *Queue) take() (Job, error) {
+	n := 0
+	for i, id := range q.queued {
+		if q.jobs[id].Priority < q.jobs[q.queued[n]].Priority {
+			n = i
+		}
+	}
+
+	id := q.queued[n]
+	q.queued = append(q.queued[:n], q.queued[n+1:]...)
+
+	j := q.jobs[id]
+	updated := j.Updated
+	j.State = StateRunning
+	j.Updated = time.Now()
+	if err := q.write(j); err != nil {
+		// job stays queued, so it is not lost and does not block adding the same metatile
+		j.State = StateQueued
+		j.Updated = updated
+		q.queued = append(q.queued[:n], append([]string{id}, q.queued[n:]...)...)
+		return Job{}, err
+	}
+
+	return *j, nil
+}
+
+// Requeue marks running job as queued again, e.g. if it could not be started now.
+func (q *Queue) Requeue(id string) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	j, found := q.jobs[id]
+	if !found || j.State != StateRunning {
+		return fmt.Errorf("jobs/Requeue: job %v is not running", id)
+	}
+
+	j.State = StateQueued
+	j.Updated = time.Now()
+	q.queued = append(q.queued, id)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return q.write(j)
+}
+
+// Finish marks job as done if err is nil, or failed otherwise.
+func (q *Queue) Finish(id string, err error) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	j, found := q.jobs[id]
+	if !found || j.Finished() {
+		return fmt.Errorf("jobs/Finish: job %v is not queued or running", id)
+	}
+
+	j.State = StateDone
+	if err != nil {
+		j.State = StateFailed
+		j.Error = err.Error()
+		q.errs[id] = err
+	}
+	j.Updated = time.Now()
+
+	delete(q.keys, j.Key)
+	if done, found := q.done[id]; found {
+		close(done)
+		delete(q.done, id)
+	}
+
+	werr := q.write(j)
+	q.trim()
+	return werr
+}
+
+// Wait waits until job is finished. Returns job and error of job, or ctx.Err().
+func (q *Queue) Wait(ctx context.Context, id string) (Job, error) {
+	q.mx.Lock()
+	j, found := q.jobs[id]
+	if !found {
+		q.mx.Unlock()
+		return Job{}, fmt.Errorf("jobs/Wait: job %v not found", id)
+	}
+	done, running := q.done[id]
+	q.mx.Unlock()
+
+	if running {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return Job{}, ctx.Err()
+		}
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	result := *j
+	if err, found := q.errs[id]; found {
+		return result, err
+	}
+	if result.State == StateFailed {
+		return result, errors.New(result.Error)
+	}
+
+	return result, nil
+}
+
+// Get returns job by id.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	j, found := q.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+
+	return *j, true
+}
+
+// List returns all jobs, sorted by creation time.
+func (q *Queue) List() []Job {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return q.sorted()
+}
+
+// Len returns count of queued jobs.
+func (q *Queue) Len() int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return len(q.queued)
+}
+
+// Close closes log file. Queued and running jobs are restored on next opening.
+func (q *Queue) Close() error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+	close(q.quit)
+	return q.file.Close()
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,233 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+func testQueue(t *testing.T) (*Queue, string, func()) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "jobs.log")
+	q, err := Open(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return q, path, func() { os.RemoveAll(dir) }
+}
+
+func testJob(x, y, priority int) Job {
+	mt := metatile.NewFromTile(tile.Tile{Zoom: 10, X: x, Y: y})
+	return New(mt, "style", priority)
+}
+
+func TestAdd(t *testing.T) {
+	q, _, cleanup := testQueue(t)
+	defer cleanup()
+	defer q.Close()
+
+	j1, added, err := q.Add(testJob(696, 320, 1))
+	if err != nil || !added || j1.ID == "" || j1.State != StateQueued {
+		t.Errorf("Add: expected new queued job, got %+v, %v, %v", j1, added, err)
+	}
+
+	// the same metatile
+	j2, added, err := q.Add(testJob(697, 321, 1))
+	if err != nil || added || j2.ID != j1.ID {
+		t.Errorf("Add: expected existing job %v, got %+v, %v, %v", j1.ID, j2, added, err)
+	}
+
+	if q.Len() != 1 {
+		t.Errorf("Len: expected 1, got %v", q.Len())
+	}
+}
+
+func TestAddLimit(t *testing.T) {
+	q, _, cleanup := testQueue(t)
+	defer cleanup()
+	defer q.Close()
+	q.limit = 1
+
+	j1, _, _ := q.Add(testJob(0, 0, 1))
+	if _, _, err := q.Add(testJob(8, 8, 1)); err != ErrQueueFull {
+		t.Errorf("Add: expected ErrQueueFull, got %v", err)
+	}
+
+	// already queued metatile is not limited
+	if j, _, err := q.Add(testJob(0, 0, 1)); err != nil || j.ID != j1.ID {
+		t.Errorf("Add: expected existing job %v, got %+v, %v", j1.ID, j, err)
+	}
+
+	// running job is not counted
+	q.Next(context.Background())
+	if _, added, err := q.Add(testJob(8, 8, 1)); err != nil || !added {
+		t.Errorf("Add: expected new job, got %v, %v", added, err)
+	}
+}
+
+func TestNextFinish(t *testing.T) {
+	q, _, cleanup := testQueue(t)
+	defer cleanup()
+	defer q.Close()
+
+	low, _, _ := q.Add(testJob(0, 0, 3))
+	high, _, _ := q.Add(testJob(8, 8, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	j, err := q.Next(ctx)
+	if err != nil || j.ID != high.ID || j.State != StateRunning {
+		t.Errorf("Next: expected running job with high priority, got %+v, %v", j, err)
+	}
+
+	errFetch := errors.New("fetch failed")
+	q.Finish(j.ID, errFetch)
+	j, err = q.Wait(ctx, high.ID)
+	if err != errFetch || j.State != StateFailed || j.Error != "fetch failed" {
+		t.Errorf("Wait: expected failed job, got %+v, %v", j, err)
+	}
+
+	// finished job does not block adding the same metatile again
+	if _, added, _ := q.Add(testJob(8, 8, 0)); !added {
+		t.Errorf("Add: expected new job after previous is finished")
+	}
+
+	j, _ = q.Next(ctx)
+	if j.ID == low.ID {
+		t.Errorf("Next: expected job with high priority first")
+	}
+}
+
+func TestReopen(t *testing.T) {
+	q, path, cleanup := testQueue(t)
+	defer cleanup()
+
+	done, _, _ := q.Add(testJob(0, 0, 1))
+	running, _, _ := q.Add(testJob(8, 8, 1))
+	queued, _, _ := q.Add(testJob(16, 16, 1))
+
+	ctx := context.Background()
+	q.Next(ctx)
+	q.Finish(done.ID, nil)
+	q.Next(ctx)
+	q.Close()
+
+	q, err := Open(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if j, _ := q.Get(done.ID); j.State != StateDone {
+		t.Errorf("Open: expected done job is kept in history, got %+v", j)
+	}
+
+	if q.Len() != 2 {
+		t.Errorf("Open: expected 2 queued jobs, got %v", q.Len())
+	}
+
+	j, _ := q.Next(ctx)
+	if j.ID != running.ID {
+		t.Errorf("Open: expected running job is queued again first, got %+v", j)
+	}
+
+	j, _ = q.Next(ctx)
+	if j.ID != queued.ID {
+		t.Errorf("Open: expected queued job, got %+v", j)
+	}
+}
+
+func TestAddCompact(t *testing.T) {
+	q, path, cleanup := testQueue(t)
+	defer cleanup()
+
+	// next write compacts log file
+	q.records = compactRecords + 1
+	j, _, err := q.Add(testJob(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.records != 1 {
+		t.Errorf("Add: expected log file is compacted, got %v records", q.records)
+	}
+	q.Close()
+
+	q, err = Open(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if got, found := q.Get(j.ID); !found || got.State != StateQueued {
+		t.Errorf("Open: expected job added during compaction is queued, got %+v, %v", got, found)
+	}
+}
+
+func TestNextWriteFailed(t *testing.T) {
+	q, _, cleanup := testQueue(t)
+	defer cleanup()
+	defer q.Close()
+
+	j, _, _ := q.Add(testJob(0, 0, 1))
+
+	// writing to closed log file fails
+	q.file.Close()
+	if _, err := q.Next(context.Background()); err == nil {
+		t.Fatalf("Next: expected error")
+	}
+
+	if got, _ := q.Get(j.ID); got.State != StateQueued || q.Len() != 1 {
+		t.Errorf("Next: expected job is queued again, got %+v, queued %v", got, q.Len())
+	}
+	if got, added, _ := q.Add(testJob(0, 0, 1)); added || got.ID != j.ID {
+		t.Errorf("Add: expected existing job %v, got %+v, %v", j.ID, got, added)
+	}
+}
+
+func TestCompactFailed(t *testing.T) {
+	q, path, cleanup := testQueue(t)
+	defer cleanup()
+
+	// temporary file can not be created
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	q.records = compactRecords + 1
+	j1, _, err := q.Add(testJob(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	// previous log file is still open
+	j2, _, err := q.Add(testJob(8, 8, 1))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	q.Close()
+	os.Remove(path + ".tmp")
+
+	q, err = Open(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for _, id := range []string{j1.ID, j2.ID} {
+		if _, found := q.Get(id); !found {
+			t.Errorf("Open: expected job %v is kept", id)
+		}
+	}
+}
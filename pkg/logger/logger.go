@@ -1,46 +1,185 @@
-// Package logger helps to configure logger with filtering.
+// Package logger implements leveled logger with key/value fields and text or json output.
+//
+// Text output:
+//
+//	2017/10/19 03:08:01 [INFO] metatile fetched request_id=8c1c5b7b6d2e0f4a metatile=style/10/0/0/33/180/128.meta
+//
+// Json output:
+//
+//	{"time":"2017-10-19T03:08:01+05:00","level":"INFO","msg":"metatile fetched","request_id":"8c1c5b7b6d2e0f4a","metatile":"style/10/0/0/33/180/128.meta"}
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger writes messages with levels and key/value fields. Fields are given as alternating keys and
+// values: l.Info("metatile fetched", "metatile", key, "upstream", url).
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+	// With returns logger, which adds fields to each message.
+	With(keysAndValues ...interface{}) Logger
+}
+
+// Options contains logger options.
+type Options struct {
+	// Show messages with DEBUG level?
+	Debug bool
+	// Show datetime in messages?
+	Datetime bool
+	// Write messages in json format instead of text?
+	JSON bool
+}
 
-	"github.com/hashicorp/logutils"
+// Levels of messages.
+const (
+	levelDebug = "DEBUG"
+	levelInfo  = "INFO"
+	levelWarn  = "WARN"
+	levelError = "ERROR"
 )
 
-// New returns new logger with filtered levels:
-//   {"DEBUG", "WARN", "ERROR", "INFO"}
-//
-// If debug=true, show messages from "DEBUG" level.
-//
-// If datetime=true, show datetime in log message.
-func New(out io.Writer, debug, datetime bool) *log.Logger {
-	levels := []logutils.LogLevel{"DEBUG", "WARN", "ERROR", "INFO"}
+// output is the destination of messages, shared by loggers created with With.
+type output struct {
+	mx   sync.Mutex
+	w    io.Writer
+	opts Options
+}
 
-	var level string
-	switch debug {
-	case true:
-		level = "DEBUG"
-	default:
-		level = "WARN"
+type logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New returns new logger, which writes messages to out. INFO, WARN and ERROR messages are shown
+// always, DEBUG messages only with opts.Debug.
+func New(out io.Writer, opts Options) Logger {
+	return &logger{out: &output{w: out, opts: opts}}
+}
+
+func (l *logger) Debug(msg string, keysAndValues ...interface{}) {
+	if l.out.opts.Debug {
+		l.log(levelDebug, msg, keysAndValues)
 	}
+}
+
+func (l *logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(levelInfo, msg, keysAndValues)
+}
+
+func (l *logger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(levelWarn, msg, keysAndValues)
+}
+
+func (l *logger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(levelError, msg, keysAndValues)
+}
 
-	var flag int
-	switch datetime {
-	case false:
-		flag = 0
-	default:
-		flag = log.LstdFlags
+func (l *logger) With(keysAndValues ...interface{}) Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return &logger{out: l.out, fields: fields}
+}
+
+func (l *logger) log(level, msg string, keysAndValues []interface{}) {
+	fields := append(append([]interface{}{}, l.fields...), keysAndValues...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	if l.out.opts.JSON {
+		writeJSON(&buf, now, level, msg, fields)
+	} else {
+		writeText(&buf, now, l.out.opts.Datetime, level, msg, fields)
+	}
+	buf.WriteByte('\n')
+
+	l.out.mx.Lock()
+	defer l.out.mx.Unlock()
+	l.out.w.Write(buf.Bytes())
+}
+
+func writeText(buf *bytes.Buffer, now time.Time, datetime bool, level, msg string, fields []interface{}) {
+	if datetime {
+		buf.WriteString(now.Format("2006/01/02 15:04:05 "))
+	}
+	fmt.Fprintf(buf, "[%v] %v", level, msg)
+
+	for i := 0; i < len(fields); i += 2 {
+		v := value(fields[i+1])
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(buf, " %v=%v", fields[i], s)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level, msg string, fields []interface{}) {
+	write := func(k string, v interface{}) {
+		key, _ := json.Marshal(k)
+		data, err := json.Marshal(v)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(v))
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(data)
+	}
+
+	buf.WriteByte('{')
+	write("time", now.Format(time.RFC3339))
+	buf.WriteByte(',')
+	write("level", level)
+	buf.WriteByte(',')
+	write("msg", msg)
+	for i := 0; i < len(fields); i += 2 {
+		buf.WriteByte(',')
+		write(fmt.Sprint(fields[i]), value(fields[i+1]))
 	}
+	buf.WriteByte('}')
+}
 
-	logger := log.New(out, "", flag)
-	filter := &logutils.LevelFilter{
-		Levels:   levels,
-		MinLevel: logutils.LogLevel(level),
-		Writer:   out,
+// value converts errors and fmt.Stringers to strings.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
 	}
 
-	logger.SetOutput(filter)
+	return v
+}
+
+type contextKey struct{}
+
+// NewContext returns context with logger l.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns logger from ctx, or fallback if ctx does not contain logger.
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
+	}
 
-	return logger
+	return fallback
 }
@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+func ExampleNew() {
+	l := New(os.Stdout, Options{})
+	l.Debug("not shown without Debug option")
+	l.With("request_id", "8c1c5b7b6d2e0f4a").Error("fetch failed", "metatile", "style/10/0/0/33/180/128.meta", "error", errors.New("response status 500"))
+
+	l = New(os.Stdout, Options{Debug: true})
+	l.Debug("cache", "found", true, "zoom", 10)
+
+	// Output:
+	// [ERROR] fetch failed request_id=8c1c5b7b6d2e0f4a metatile=style/10/0/0/33/180/128.meta error="response status 500"
+	// [DEBUG] cache found=true zoom=10
+}
+
+func ExampleFromContext() {
+	fallback := New(os.Stdout, Options{})
+	ctx := NewContext(context.Background(), fallback.With("request_id", "8c1c5b7b6d2e0f4a"))
+
+	FromContext(ctx, fallback).Info("with context")
+	FromContext(context.Background(), fallback).Info("without context")
+
+	// Output:
+	// [INFO] with context request_id=8c1c5b7b6d2e0f4a
+	// [INFO] without context
+}
@@ -0,0 +1,278 @@
+// Package metrics implements counters, histograms and gauges with labels, and exposes them in
+// Prometheus text format.
+//
+// Metrics are registered in the default registry on creation, so packages declare their metrics as
+// package variables:
+//
+//	var requests = metrics.NewCounter("metatiles_http_requests_total", "Count of requests.", "source", "code")
+//
+//	requests.Inc("style", "200")
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is the metric, which can be written in text format.
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry contains metrics.
+type Registry struct {
+	mx      sync.Mutex
+	metrics []metric
+}
+
+// Default is the default registry.
+var Default = &Registry{}
+
+func (r *Registry) register(m metric) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all metrics in Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mx.Lock()
+	metrics := make([]metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mx.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler returns http handler, which writes metrics from the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.Write(w)
+	})
+}
+
+// desc contains metric description and label names.
+type desc struct {
+	fqName string
+	help   string
+	labels []string
+}
+
+func (d desc) name() string {
+	return d.fqName
+}
+
+func (d desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", d.fqName, d.help, d.fqName, typ)
+}
+
+// key returns key of label values. Panics if count of values is not equal to count of labels.
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %v: expected %v label values, got %v", d.fqName, len(d.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// pairs formats label pairs with extra pair (if name is not empty): {a="1",le="0.5"}.
+func (d desc) pairs(values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, l := range d.labels {
+		pairs = append(pairs, l+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Counter is the monotonically increasing value with labels.
+type Counter struct {
+	desc
+	mx     sync.Mutex
+	values map[string]*sample
+}
+
+// sample contains label values and value.
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// NewCounter creates counter and registers it in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{fqName: name, help: help, labels: labels}, values: make(map[string]*sample)}
+	Default.register(c)
+	return c
+}
+
+// Inc increments counter with label values by 1.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Add adds v to counter with label values.
+func (c *Counter) Add(v float64, labels ...string) {
+	key := c.key(labels)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	s, found := c.values[key]
+	if !found {
+		s = &sample{labels: append([]string(nil), labels...)}
+		c.values[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.header(w, "counter")
+	for _, k := range sortedKeys(c.values) {
+		s := c.values[k]
+		fmt.Fprintf(w, "%v%v %v\n", c.fqName, c.pairs(s.labels, "", ""), formatFloat(s.value))
+	}
+}
+
+// Histogram counts observed values in buckets with labels.
+type Histogram struct {
+	desc
+	buckets []float64
+	mx      sync.Mutex
+	values  map[string]*histogramSample
+}
+
+type histogramSample struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates histogram with sorted upper bounds of buckets and registers it in the
+// default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{fqName: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramSample),
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe adds v to histogram with label values.
+func (h *Histogram) Observe(v float64, labels ...string) {
+	key := h.key(labels)
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	s, found := h.values[key]
+	if !found {
+		s = &histogramSample{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		s := h.values[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.fqName, h.pairs(s.labels, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.fqName, h.pairs(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.fqName, h.pairs(s.labels, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.fqName, h.pairs(s.labels, "", ""), s.count)
+	}
+}
+
+// Sample is the gauge value with label values.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc is the gauge, which values are collected by function on each writing.
+type GaugeFunc struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc creates gauge and registers it in the default registry. fn returns current values
+// with label values.
+func NewGaugeFunc(name, help string, fn func() []Sample, labels ...string) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{fqName: name, help: help, labels: labels}, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w, "gauge")
+	for _, s := range g.fn() {
+		g.key(s.Labels)
+		fmt.Fprintf(w, "%v%v %v\n", g.fqName, g.pairs(s.Labels, "", ""), formatFloat(s.Value))
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]*sample:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramSample:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"os"
+)
+
+func ExampleCounter() {
+	c := NewCounter("example_requests_total", "Count of requests.", "source", "code")
+	c.Inc("style", "200")
+	c.Inc("style", "200")
+	c.Add(3, "style", "404")
+	c.Inc(`a"b`, "200")
+
+	c.write(os.Stdout)
+
+	// Output:
+	// # HELP example_requests_total Count of requests.
+	// # TYPE example_requests_total counter
+	// example_requests_total{source="a\"b",code="200"} 1
+	// example_requests_total{source="style",code="200"} 2
+	// example_requests_total{source="style",code="404"} 3
+}
+
+func ExampleHistogram() {
+	h := NewHistogram("example_duration_seconds", "Duration of requests.", []float64{0.1, 1}, "source")
+	h.Observe(0.05, "style")
+	h.Observe(0.5, "style")
+	h.Observe(5, "style")
+
+	h.write(os.Stdout)
+
+	// Output:
+	// # HELP example_duration_seconds Duration of requests.
+	// # TYPE example_duration_seconds histogram
+	// example_duration_seconds_bucket{source="style",le="0.1"} 1
+	// example_duration_seconds_bucket{source="style",le="1"} 2
+	// example_duration_seconds_bucket{source="style",le="+Inf"} 3
+	// example_duration_seconds_sum{source="style"} 5.55
+	// example_duration_seconds_count{source="style"} 3
+}
+
+func ExampleGaugeFunc() {
+	g := NewGaugeFunc("example_queue_length", "Count of queued items.", func() []Sample {
+		return []Sample{{Labels: nil, Value: 42}}
+	})
+
+	g.write(os.Stdout)
+
+	// Output:
+	// # HELP example_queue_length Count of queued items.
+	// # TYPE example_queue_length gauge
+	// example_queue_length 42
+}
@@ -0,0 +1,161 @@
+// Package negcache implements in-memory cache of keys known to be missing or failing on remote
+// source. Entries expire after given ttl. Cache can be saved to and loaded from file.
+package negcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is the negative cache entry.
+type Entry struct {
+	Reason   string    `json:"reason"`
+	NotFound bool      `json:"not_found"`
+	Expire   time.Time `json:"expire"`
+}
+
+// Cache contains mutex and map of entries.
+type Cache struct {
+	mx sync.RWMutex
+	m  map[string]Entry
+}
+
+// New creates new empty Cache.
+func New() *Cache {
+	return &Cache{
+		m: make(map[string]Entry),
+	}
+}
+
+// Add adds entry with given key for ttl duration. Zero ttl does nothing.
+func (c *Cache) Add(key string, e Entry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	e.Expire = time.Now().Add(ttl)
+	c.m[key] = e
+}
+
+// Get returns entry for key if it exists and not expired.
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mx.RLock()
+	e, found := c.m[key]
+	c.mx.RUnlock()
+
+	if !found {
+		return Entry{}, false
+	}
+
+	if time.Now().After(e.Expire) {
+		c.mx.Lock()
+		// entry may be added again after RUnlock
+		if e, found := c.m[key]; found && time.Now().After(e.Expire) {
+			delete(c.m, key)
+		}
+		c.mx.Unlock()
+		return Entry{}, false
+	}
+
+	return e, true
+}
+
+// Del deletes entry with given key.
+func (c *Cache) Del(key string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	delete(c.m, key)
+}
+
+// Len returns count of entries, including expired but not purged yet.
+func (c *Cache) Len() int {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return len(c.m)
+}
+
+// Purge deletes expired entries. Returns count of deleted entries.
+func (c *Cache) Purge() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	n := 0
+	for k, e := range c.m {
+		if now.After(e.Expire) {
+			delete(c.m, k)
+			n++
+		}
+	}
+
+	return n
+}
+
+// Save writes not expired entries to file in json format.
+func (c *Cache) Save(path string) error {
+	c.Purge()
+
+	c.mx.RLock()
+	data, err := json.Marshal(c.m)
+	c.mx.RUnlock()
+	if err != nil {
+		return fmt.Errorf("negcache/Save: %v", err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "negcache")
+	if err != nil {
+		return fmt.Errorf("negcache/Save: %v", err)
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		return fmt.Errorf("negcache/Save: %v", err)
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("negcache/Save: %v", err)
+	}
+
+	return nil
+}
+
+// Load reads entries from file, created by Save. Expired entries are skipped. If file does not
+// exist, do nothing.
+func (c *Cache) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("negcache/Load: %v", err)
+	}
+
+	var m map[string]Entry
+	if err = json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("negcache/Load: %v", err)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	for k, e := range m {
+		if now.After(e.Expire) {
+			continue
+		}
+		c.m[k] = e
+	}
+
+	return nil
+}
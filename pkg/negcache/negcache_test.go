@@ -0,0 +1,67 @@
+package negcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddGet(t *testing.T) {
+	c := New()
+	c.Add("key", Entry{Reason: "not found", NotFound: true}, time.Hour)
+	c.Add("disabled", Entry{Reason: "error"}, 0)
+	c.Add("expired", Entry{Reason: "error"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	e, found := c.Get("key")
+	if !found || !e.NotFound || e.Reason != "not found" {
+		t.Errorf("Get: expected not found entry, got %+v, %v", e, found)
+	}
+
+	if _, found = c.Get("disabled"); found {
+		t.Errorf("Get: expected entry with zero ttl is not added")
+	}
+
+	if _, found = c.Get("expired"); found {
+		t.Errorf("Get: expected expired entry is not found")
+	}
+
+	if c.Len() != 1 {
+		t.Errorf("Len: expected 1, got %v", c.Len())
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "negcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "negcache.json")
+
+	c := New()
+	if err = c.Load(path); err != nil {
+		t.Errorf("Load: expected no error for missing file, got %v", err)
+	}
+
+	c.Add("key1", Entry{Reason: "not found", NotFound: true}, time.Hour)
+	c.Add("key2", Entry{Reason: "error"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err = c.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	c2 := New()
+	if err = c2.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if _, found := c2.Get("key1"); !found {
+		t.Errorf("Load: expected key1 is loaded")
+	}
+	if c2.Len() != 1 {
+		t.Errorf("Load: expected 1 entry, got %v", c2.Len())
+	}
+}
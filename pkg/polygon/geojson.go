@@ -0,0 +1,103 @@
+package polygon
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+)
+
+// geoJSON is the GeoJSON object: geometry, Feature or FeatureCollection.
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Features    []geoJSON       `json:"features"`
+}
+
+// NewFromGeoJSON creates region from GeoJSON Polygon, MultiPolygon, Feature or FeatureCollection
+// with this geometries. Only exterior rings of polygons are used, holes are ignored.
+func NewFromGeoJSON(data []byte) (Region, error) {
+	var g geoJSON
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("GeoJSON: %v", err)
+	}
+
+	region, err := g.region()
+	if err != nil {
+		return nil, fmt.Errorf("GeoJSON: %v", err)
+	}
+
+	if len(region) == 0 {
+		return nil, fmt.Errorf("GeoJSON: no polygons found")
+	}
+
+	return region, nil
+}
+
+func (g geoJSON) region() (Region, error) {
+	switch g.Type {
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		p, err := ring(rings)
+		if err != nil {
+			return nil, err
+		}
+		return Region{p}, nil
+
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+		var region Region
+		for _, rings := range polygons {
+			p, err := ring(rings)
+			if err != nil {
+				return nil, err
+			}
+			region = append(region, p)
+		}
+		return region, nil
+
+	case "Feature":
+		if g.Geometry == nil {
+			return nil, fmt.Errorf("feature without geometry")
+		}
+		return g.Geometry.region()
+
+	case "FeatureCollection":
+		var region Region
+		for _, f := range g.Features {
+			r, err := f.region()
+			if err != nil {
+				return nil, err
+			}
+			region = append(region, r...)
+		}
+		return region, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type: %q", g.Type)
+}
+
+// ring converts exterior ring of GeoJSON polygon to Polygon. GeoJSON positions are in
+// [longitude, latitude] order.
+func ring(rings [][][]float64) (Polygon, error) {
+	if len(rings) == 0 || len(rings[0]) < 3 {
+		return nil, fmt.Errorf("polygon must contain at least 3 positions")
+	}
+
+	var p Polygon
+	for _, pos := range rings[0] {
+		if len(pos) < 2 {
+			return nil, fmt.Errorf("wrong position: %v", pos)
+		}
+		p = append(p, latlong.LatLong{Lat: pos[1], Long: pos[0]})
+	}
+
+	return p, nil
+}
@@ -0,0 +1,32 @@
+package polygon
+
+import "fmt"
+
+func ExampleNewFromGeoJSON() {
+	data := []string{
+		`{"type": "Polygon", "coordinates": [[[37.3, 55.9], [37.9, 55.9], [37.9, 55.5], [37.3, 55.9]]]}`,
+		`{"type": "FeatureCollection", "features": [
+			{"type": "Feature", "geometry": {"type": "MultiPolygon", "coordinates": [
+				[[[0, 0], [0, 1], [1, 1], [0, 0]]],
+				[[[5, 5], [5, 6], [6, 6], [5, 5]]]
+			]}}
+		]}`,
+		`{"type": "Point", "coordinates": [37.3, 55.9]}`,
+		`{"type": "Polygon", "coordinates": [[[37.3, 55.9]]]}`,
+	}
+
+	for _, d := range data {
+		region, err := NewFromGeoJSON([]byte(d))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(len(region), region[0][0])
+	}
+
+	// Output:
+	// 1 LatLong{55.9-37.3}
+	// 2 LatLong{0-0}
+	// GeoJSON: unsupported type: "Point"
+	// GeoJSON: polygon must contain at least 3 positions
+}
@@ -0,0 +1,138 @@
+package polygon
+
+import (
+	"math"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+)
+
+// Relation is the relation between polygon and rectangle.
+type Relation int
+
+const (
+	// Outside means rectangle and polygon have no common points.
+	Outside Relation = iota
+	// Intersects means rectangle and polygon have common points, but rectangle is not inside
+	// polygon.
+	Intersects
+	// Inside means rectangle is inside polygon.
+	Inside
+)
+
+// Relate returns relation between polygon and rectangle with top-left and bottom-right corners.
+// Touching borders are counted as intersection.
+func (p Polygon) Relate(top, bottom latlong.LatLong) Relation {
+	pl := len(p)
+	if pl < 3 {
+		return Outside
+	}
+
+	minLat, maxLat := math.Min(top.Lat, bottom.Lat), math.Max(top.Lat, bottom.Lat)
+	minLong, maxLong := math.Min(top.Long, bottom.Long), math.Max(top.Long, bottom.Long)
+	corners := [4]latlong.LatLong{
+		{Lat: maxLat, Long: minLong},
+		{Lat: maxLat, Long: maxLong},
+		{Lat: minLat, Long: maxLong},
+		{Lat: minLat, Long: minLong},
+	}
+
+	// if polygon is not closed, use last point as first point.
+	prev := pl - 1
+	if p[0] == p[pl-1] {
+		prev = 0
+	}
+
+	for i := 0; i < pl; i++ {
+		if i == prev {
+			continue
+		}
+		a, b := p[prev], p[i]
+		prev = i
+
+		// skip edges outside of rectangle bounds
+		if math.Max(a.Lat, b.Lat) < minLat || math.Min(a.Lat, b.Lat) > maxLat ||
+			math.Max(a.Long, b.Long) < minLong || math.Min(a.Long, b.Long) > maxLong {
+			continue
+		}
+
+		for j := range corners {
+			if segmentsIntersect(a, b, corners[j], corners[(j+1)%4]) {
+				return Intersects
+			}
+		}
+	}
+
+	// borders do not intersect: polygon is inside rectangle, rectangle is inside polygon or
+	// they have no common points.
+	if p[0].Lat >= minLat && p[0].Lat <= maxLat && p[0].Long >= minLong && p[0].Long <= maxLong {
+		return Intersects
+	}
+
+	if p.Contains(corners[0]) {
+		return Inside
+	}
+
+	return Outside
+}
+
+// Relate returns relation between region and rectangle with top-left and bottom-right corners.
+// Rectangle is inside region, if it is inside one of polygons.
+func (r Region) Relate(top, bottom latlong.LatLong) Relation {
+	result := Outside
+	for _, p := range r {
+		switch p.Relate(top, bottom) {
+		case Inside:
+			return Inside
+		case Intersects:
+			result = Intersects
+		}
+	}
+
+	return result
+}
+
+// Bounds returns top-left and bottom-right corners of rectangle, which contains all points of
+// region.
+func (r Region) Bounds() (top, bottom latlong.LatLong) {
+	top = latlong.LatLong{Lat: math.Inf(-1), Long: math.Inf(1)}
+	bottom = latlong.LatLong{Lat: math.Inf(1), Long: math.Inf(-1)}
+	for _, p := range r {
+		for _, pt := range p {
+			top.Lat = math.Max(top.Lat, pt.Lat)
+			top.Long = math.Min(top.Long, pt.Long)
+			bottom.Lat = math.Min(bottom.Lat, pt.Lat)
+			bottom.Long = math.Max(bottom.Long, pt.Long)
+		}
+	}
+
+	return top, bottom
+}
+
+// segmentsIntersect checks if segments ab and cd have common points.
+func segmentsIntersect(a, b, c, d latlong.LatLong) bool {
+	d1 := orientation(c, d, a)
+	d2 := orientation(c, d, b)
+	d3 := orientation(a, b, c)
+	d4 := orientation(a, b, d)
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	return d1 == 0 && onSegment(c, d, a) ||
+		d2 == 0 && onSegment(c, d, b) ||
+		d3 == 0 && onSegment(a, b, c) ||
+		d4 == 0 && onSegment(a, b, d)
+}
+
+// orientation returns cross product of vectors ab and ac: positive, if c is on the left of ab,
+// negative, if on the right, zero, if points are collinear.
+func orientation(a, b, c latlong.LatLong) float64 {
+	return (b.Lat-a.Lat)*(c.Long-a.Long) - (b.Long-a.Long)*(c.Lat-a.Lat)
+}
+
+// onSegment checks if collinear point c is on the segment ab.
+func onSegment(a, b, c latlong.LatLong) bool {
+	return c.Lat >= math.Min(a.Lat, b.Lat) && c.Lat <= math.Max(a.Lat, b.Lat) &&
+		c.Long >= math.Min(a.Long, b.Long) && c.Long <= math.Max(a.Long, b.Long)
+}
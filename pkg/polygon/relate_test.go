@@ -0,0 +1,73 @@
+package polygon
+
+import (
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+)
+
+func TestPolygonRelate(t *testing.T) {
+	// triangle, not closed
+	polygon := Polygon{
+		latlong.LatLong{Lat: 0, Long: 0},
+		latlong.LatLong{Lat: 10, Long: 0},
+		latlong.LatLong{Lat: 0, Long: 10},
+	}
+
+	testData := []struct {
+		top, bottom latlong.LatLong
+		result      Relation
+	}{
+		// inside
+		{latlong.LatLong{Lat: 3, Long: 1}, latlong.LatLong{Lat: 1, Long: 3}, Inside},
+		// crosses hypotenuse
+		{latlong.LatLong{Lat: 6, Long: 4}, latlong.LatLong{Lat: 4, Long: 6}, Intersects},
+		// bounding box intersects, polygon does not
+		{latlong.LatLong{Lat: 9, Long: 8}, latlong.LatLong{Lat: 8, Long: 9}, Outside},
+		// far away
+		{latlong.LatLong{Lat: 30, Long: 20}, latlong.LatLong{Lat: 20, Long: 30}, Outside},
+		// polygon inside rectangle
+		{latlong.LatLong{Lat: 20, Long: -10}, latlong.LatLong{Lat: -10, Long: 20}, Intersects},
+		// touches vertex
+		{latlong.LatLong{Lat: 0, Long: -5}, latlong.LatLong{Lat: -5, Long: 0}, Intersects},
+	}
+
+	for _, tt := range testData {
+		result := polygon.Relate(tt.top, tt.bottom)
+		if result != tt.result {
+			t.Errorf("Polygon.Relate(%v, %v): expected %v, got %v", tt.top, tt.bottom, tt.result, result)
+		}
+	}
+}
+
+func TestRegionRelate(t *testing.T) {
+	region := Region{
+		Polygon{
+			latlong.LatLong{Lat: 10, Long: 0},
+			latlong.LatLong{Lat: 0, Long: 0},
+			latlong.LatLong{Lat: 0, Long: 5},
+			latlong.LatLong{Lat: 10, Long: 5},
+			latlong.LatLong{Lat: 10, Long: 0},
+		},
+		Polygon{
+			latlong.LatLong{Lat: 10, Long: 20},
+			latlong.LatLong{Lat: 0, Long: 20},
+			latlong.LatLong{Lat: 0, Long: 25},
+			latlong.LatLong{Lat: 10, Long: 25},
+			latlong.LatLong{Lat: 10, Long: 20},
+		},
+	}
+
+	if r := region.Relate(latlong.LatLong{Lat: 5, Long: 21}, latlong.LatLong{Lat: 4, Long: 22}); r != Inside {
+		t.Errorf("Region.Relate: expected Inside, got %v", r)
+	}
+
+	if r := region.Relate(latlong.LatLong{Lat: 5, Long: 10}, latlong.LatLong{Lat: 4, Long: 15}); r != Outside {
+		t.Errorf("Region.Relate: expected Outside, got %v", r)
+	}
+
+	top, bottom := region.Bounds()
+	if top != (latlong.LatLong{Lat: 10, Long: 0}) || bottom != (latlong.LatLong{Lat: 0, Long: 25}) {
+		t.Errorf("Region.Bounds: got %v, %v", top, bottom)
+	}
+}
@@ -0,0 +1,137 @@
+// Package queue implements group of flights, where only one call for key runs at the same time.
+package queue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrWaitTimeout is the error if Wait timeout achieved.
+var ErrWaitTimeout = errors.New("wait timeout")
+
+// Group contains running flights by key. Only one flight for key runs at the same time, other
+// callers join it and get its result.
+type Group struct {
+	mx sync.Mutex
+	m  map[string]*Flight
+}
+
+// Flight is the function call running for key. Result and error of the call are delivered to all
+// waiters.
+type Flight struct {
+	Key     string
+	Started time.Time
+
+	group   *Group
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+}
+
+// FlightInfo contains information about running flight.
+type FlightInfo struct {
+	Key     string        `json:"key"`
+	Age     time.Duration `json:"age"`
+	Waiters int           `json:"waiters"`
+}
+
+// NewGroup creates new Group.
+func NewGroup() *Group {
+	return &Group{
+		m: make(map[string]*Flight),
+	}
+}
+
+// Start atomically joins running flight for key (returns false), or creates new flight which runs
+// fn in separate goroutine (returns true). Flight is deleted from group when fn returns.
+func (g *Group) Start(key string, fn func() (interface{}, error)) (*Flight, bool) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	if f, found := g.m[key]; found {
+		return f, false
+	}
+
+	f := &Flight{
+		Key:     key,
+		Started: time.Now(),
+		group:   g,
+		done:    make(chan struct{}),
+	}
+	g.m[key] = f
+
+	go func() {
+		f.val, f.err = fn()
+
+		g.mx.Lock()
+		delete(g.m, key)
+		g.mx.Unlock()
+
+		close(f.done)
+	}()
+
+	return f, true
+}
+
+// Do starts or joins flight for key and waits for its result. See Flight.Wait.
+func (g *Group) Do(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, leader bool, err error) {
+	f, leader := g.Start(key, fn)
+	v, err = f.Wait(ctx)
+	return v, leader, err
+}
+
+// Wait waits until flight is complete and returns its result and error. If ctx is done before,
+// returns ctx.Err(), flight continues running for other waiters.
+func (f *Flight) Wait(ctx context.Context) (interface{}, error) {
+	f.group.mx.Lock()
+	f.waiters++
+	f.group.mx.Unlock()
+
+	defer func() {
+		f.group.mx.Lock()
+		f.waiters--
+		f.group.mx.Unlock()
+	}()
+
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Done returns channel, which is closed when flight is complete.
+func (f *Flight) Done() <-chan struct{} {
+	return f.done
+}
+
+// Len returns count of running flights.
+func (g *Group) Len() int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	return len(g.m)
+}
+
+// Flights returns information about running flights, sorted by key.
+func (g *Group) Flights() []FlightInfo {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	now := time.Now()
+	result := make([]FlightInfo, 0, len(g.m))
+	for _, f := range g.m {
+		result = append(result, FlightInfo{
+			Key:     f.Key,
+			Age:     now.Sub(f.Started),
+			Waiters: f.waiters,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
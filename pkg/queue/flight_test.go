@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupDo(t *testing.T) {
+	g := NewGroup()
+	errFetch := errors.New("fetch failed")
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "data", errFetch
+	}
+
+	var wg sync.WaitGroup
+	var leaders int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, leader, err := g.Do(context.Background(), "key", fn)
+			if leader {
+				atomic.AddInt32(&leaders, 1)
+			}
+			if v != "data" || err != errFetch {
+				t.Errorf("Do: expected (data, %v), got (%v, %v)", errFetch, v, err)
+			}
+		}()
+	}
+
+	// wait until all callers joined the flight
+	for {
+		flights := g.Flights()
+		if len(flights) == 1 && flights[0].Waiters == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || leaders != 1 {
+		t.Errorf("Do: expected 1 call and 1 leader, got %v and %v", calls, leaders)
+	}
+
+	if g.Len() != 0 {
+		t.Errorf("Len: expected 0 after flight complete, got %v", g.Len())
+	}
+}
+
+func TestFlightWaitCancel(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	f, leader := g.Start("key", func() (interface{}, error) {
+		<-release
+		return "data", nil
+	})
+	if !leader {
+		t.Fatalf("Start: expected leader for new key")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Wait: expected DeadlineExceeded, got %v", err)
+	}
+
+	// flight continues running after waiter cancellation
+	f2, leader := g.Start("key", nil)
+	if leader || f2 != f {
+		t.Errorf("Start: expected to join running flight")
+	}
+
+	close(release)
+	v, err := f2.Wait(context.Background())
+	if v != "data" || err != nil {
+		t.Errorf("Wait: expected (data, nil), got (%v, %v)", v, err)
+	}
+}
@@ -0,0 +1,240 @@
+package seed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+)
+
+// Seeding job states.
+const (
+	StateRunning  = "running"
+	StatePaused   = "paused"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
+)
+
+var (
+	// ErrNotFound is the error returned if job is not found.
+	ErrNotFound = errors.New("seed job not found")
+	// ErrFinished is the error returned if job is already finished.
+	ErrFinished = errors.New("seed job is finished")
+)
+
+// Job is the seeding job, started by Manager.
+type Job struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Zooms  []int  `json:"zooms"`
+	// Area is the short description of seeding area.
+	Area     string     `json:"area"`
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	Progress Progress   `json:"progress"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+type managedJob struct {
+	job    Job
+	seeder *Seeder
+	cancel context.CancelFunc
+}
+
+// Manager runs seeding jobs in the background and keeps history of finished jobs.
+type Manager struct {
+	fetcher *fetch.Fetch
+	cache   cache.ReadWriter
+	logger  logger.Logger
+	history int
+
+	mx    sync.Mutex
+	jobs  map[string]*managedJob
+	order []string
+}
+
+// NewManager creates new Manager. Keeps history of last history finished jobs.
+func NewManager(fetcher *fetch.Fetch, c cache.ReadWriter, logger logger.Logger, history int) *Manager {
+	return &Manager{
+		fetcher: fetcher,
+		cache:   c,
+		logger:  logger,
+		history: history,
+		jobs:    make(map[string]*managedJob),
+	}
+}
+
+// Start starts seeding with opts in the background and returns new job. Area is the description
+// of seeding area for the job. Seeder messages are logged with job id in "seed" field.
+func (m *Manager) Start(opts Options, area string) Job {
+	id := newID()
+	l := m.logger.With("seed", id)
+	s := New(opts, m.fetcher, m.cache, l)
+	ctx, cancel := context.WithCancel(context.Background())
+	mj := &managedJob{
+		job: Job{
+			ID:       id,
+			Source:   opts.Source.Name,
+			Zooms:    opts.Zooms,
+			Area:     area,
+			State:    StateRunning,
+			Progress: s.Progress(),
+			Created:  time.Now(),
+		},
+		seeder: s,
+		cancel: cancel,
+	}
+
+	m.mx.Lock()
+	m.jobs[mj.job.ID] = mj
+	m.order = append(m.order, mj.job.ID)
+	m.mx.Unlock()
+
+	l.Info("seed: job started", "area", area, "source", opts.Source.Name, "zooms", opts.Zooms, "metatiles", mj.job.Progress.Total)
+	go m.run(ctx, mj)
+
+	return mj.job
+}
+
+func (m *Manager) run(ctx context.Context, mj *managedJob) {
+	err := mj.seeder.Run(ctx)
+	progress := mj.seeder.Progress()
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	mj.job.Progress = progress
+	now := time.Now()
+	mj.job.Finished = &now
+	switch {
+	case err == context.Canceled:
+		mj.job.State = StateCanceled
+	case err != nil:
+		mj.job.State = StateFailed
+		mj.job.Error = err.Error()
+	default:
+		mj.job.State = StateDone
+	}
+	mj.cancel()
+	mj.seeder.logger.Info("seed: job finished", "state", mj.job.State, "progress", progress)
+
+	m.compact()
+}
+
+// compact removes the oldest finished jobs over history limit. m.mx must be locked.
+func (m *Manager) compact() {
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].job.Finished == nil {
+			continue
+		}
+		finished++
+	}
+
+	var order []string
+	for _, id := range m.order {
+		if finished > m.history && m.jobs[id].job.Finished != nil {
+			delete(m.jobs, id)
+			finished--
+			continue
+		}
+		order = append(order, id)
+	}
+	m.order = order
+}
+
+// snapshot returns job with current progress. m.mx must be locked.
+func (m *Manager) snapshot(mj *managedJob) Job {
+	j := mj.job
+	if j.Finished == nil {
+		j.Progress = mj.seeder.Progress()
+		if mj.seeder.Paused() {
+			j.State = StatePaused
+		}
+	}
+
+	return j
+}
+
+// Get returns job by id.
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	mj, found := m.jobs[id]
+	if !found {
+		return Job{}, false
+	}
+
+	return m.snapshot(mj), true
+}
+
+// List returns all jobs, from the oldest to the newest.
+func (m *Manager) List() []Job {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	result := make([]Job, 0, len(m.order))
+	for _, id := range m.order {
+		result = append(result, m.snapshot(m.jobs[id]))
+	}
+
+	return result
+}
+
+// Pause pauses running job.
+func (m *Manager) Pause(id string) (Job, error) {
+	return m.control(id, func(mj *managedJob) { mj.seeder.Pause() })
+}
+
+// Resume resumes paused job.
+func (m *Manager) Resume(id string) (Job, error) {
+	return m.control(id, func(mj *managedJob) { mj.seeder.Resume() })
+}
+
+// Cancel cancels running or paused job. Job state is changed to canceled after metatiles, which
+// are fetching now.
+func (m *Manager) Cancel(id string) (Job, error) {
+	return m.control(id, func(mj *managedJob) { mj.cancel() })
+}
+
+// CancelAll cancels all running and paused jobs.
+func (m *Manager) CancelAll() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	for _, mj := range m.jobs {
+		mj.cancel()
+	}
+}
+
+func (m *Manager) control(id string, fn func(mj *managedJob)) (Job, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	mj, found := m.jobs[id]
+	if !found {
+		return Job{}, ErrNotFound
+	}
+
+	if mj.job.Finished != nil {
+		return mj.job, ErrFinished
+	}
+
+	fn(mj)
+	return m.snapshot(mj), nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,113 @@
+package seed
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// cachedAll is the cache, which contains all metatiles.
+type cachedAll struct{}
+
+func (cachedAll) Read(ctx context.Context, t tile.Tile) (tile.Data, error) { return nil, nil }
+func (cachedAll) Check(ctx context.Context, t tile.Tile) (bool, time.Time) { return true, time.Now() }
+func (cachedAll) Write(ctx context.Context, m metatile.Metatile, data metatile.Data) error {
+	return nil
+}
+
+func waitState(t *testing.T, m *Manager, id, state string) Job {
+	for i := 0; i < 100; i++ {
+		j, _ := m.Get(id)
+		if j.State == state {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	j, _ := m.Get(id)
+	t.Fatalf("job %v: expected state %v, got %+v", id, state, j)
+	return j
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager(nil, cachedAll{}, logger.New(ioutil.Discard, logger.Options{}), 1)
+	world := Options{
+		Source: config.Source{Name: "style"},
+		Top:    latlong.LatLong{Lat: 85, Long: -180},
+		Bottom: latlong.LatLong{Lat: -85, Long: 179.9},
+	}
+
+	small := world
+	small.Zooms = []int{1, 2, 3}
+	j := m.Start(small, "bbox")
+	j = waitState(t, m, j.ID, StateDone)
+	if j.Progress.Total != 3 || j.Progress.Skipped != 3 {
+		t.Errorf("expected 3 skipped metatiles, got %+v", j.Progress)
+	}
+
+	if _, err := m.Pause(j.ID); err != ErrFinished {
+		t.Errorf("Pause: expected ErrFinished for finished job, got %v", err)
+	}
+
+	large := world
+	large.Zooms = []int{14, 15, 16}
+	j = m.Start(large, "bbox")
+	if j, err := m.Pause(j.ID); err != nil || j.State != StatePaused {
+		t.Errorf("Pause: expected paused job, got %+v, %v", j, err)
+	}
+
+	processed := waitState(t, m, j.ID, StatePaused).Progress.Processed
+	time.Sleep(20 * time.Millisecond)
+	if p, _ := m.Get(j.ID); p.Progress.Processed > processed+2 {
+		t.Errorf("expected paused job does not process metatiles, got %v > %v", p.Progress.Processed, processed)
+	}
+
+	m.Cancel(j.ID)
+	waitState(t, m, j.ID, StateCanceled)
+
+	// history is 1: the first finished job is removed
+	if jobs := m.List(); len(jobs) != 1 || jobs[0].ID != j.ID {
+		t.Errorf("List: expected only the last job, got %+v", jobs)
+	}
+
+	if _, err := m.Cancel("unknown"); err != ErrNotFound {
+		t.Errorf("Cancel: expected ErrNotFound, got %v", err)
+	}
+}
+
+// cachedNone is the cache, which does not contain metatiles.
+type cachedNone struct{ cachedAll }
+
+func (cachedNone) Check(ctx context.Context, t tile.Tile) (bool, time.Time) {
+	return false, time.Time{}
+}
+
+func TestManagerCancelFetching(t *testing.T) {
+	// fetcher without workers: metatiles wait in the queue until seeding is canceled
+	f := fetch.New(config.Fetch{QueueDepth: 10}, logger.New(ioutil.Discard, logger.Options{}))
+	defer f.Shutdown(context.Background())
+
+	m := NewManager(f, cachedNone{}, logger.New(ioutil.Discard, logger.Options{}), 1)
+	j := m.Start(Options{
+		Source:  config.Source{Name: "style"},
+		Zooms:   []int{1},
+		Workers: 1,
+		Top:     latlong.LatLong{Lat: 85, Long: -180},
+		Bottom:  latlong.LatLong{Lat: -85, Long: 179.9},
+	}, "bbox")
+	time.Sleep(20 * time.Millisecond)
+
+	m.Cancel(j.ID)
+	j = waitState(t, m, j.ID, StateCanceled)
+	if j.Progress.Failed != 0 {
+		t.Errorf("expected canceled fetching is not failed, got %+v", j.Progress)
+	}
+}
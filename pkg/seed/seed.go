@@ -0,0 +1,363 @@
+// Package seed contains seeder, which pre-populates metatiles cache for the area and zoom levels
+// using fetcher directly.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tierpod/metatiles-cacher/pkg/bbox"
+	"github.com/tierpod/metatiles-cacher/pkg/cache"
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/fetch"
+	"github.com/tierpod/metatiles-cacher/pkg/latlong"
+	"github.com/tierpod/metatiles-cacher/pkg/logger"
+	"github.com/tierpod/metatiles-cacher/pkg/metatile"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+)
+
+// queueFullDelay is the delay before retrying metatile, if fetching queue is full.
+const queueFullDelay = time.Second
+
+// Options contains seeding options.
+type Options struct {
+	Source config.Source
+	Zooms  []int
+	// Top-left and bottom-right corners of the area.
+	Top, Bottom latlong.LatLong
+	// If set, only metatiles intersecting region are seeded, Top and Bottom are ignored.
+	Region polygon.Region
+	// Skip metatiles cached less than MaxAge ago. Zero value skips all cached metatiles.
+	MaxAge time.Duration
+	// Count of metatiles fetching at the same time.
+	Workers int
+	// Maximum count of metatiles per second. Zero value means no limit.
+	Rate float64
+	// Path to file for saving progress. If set, seeding resumes from saved position.
+	StateFile string
+}
+
+// key returns string, which identifies seeding area.
+func (o Options) key() string {
+	if len(o.Region) > 0 {
+		return fmt.Sprintf("%v %v region:%x", o.Source.Name, o.Zooms, crc32.ChecksumIEEE([]byte(fmt.Sprint(o.Region))))
+	}
+	return fmt.Sprintf("%v %v %v %v", o.Source.Name, o.Zooms, o.Top, o.Bottom)
+}
+
+// Progress contains seeding progress.
+type Progress struct {
+	// Total count of metatiles in the area.
+	Total int `json:"total"`
+	// Count of processed metatiles, including skipped and failed.
+	Processed int `json:"processed"`
+	Done      int `json:"done"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Metatiles per second.
+	Rate    float64       `json:"rate"`
+	ETA     time.Duration `json:"eta"`
+	Started time.Time     `json:"started"`
+}
+
+// MarshalJSON implements json.Marshaler interface. ETA is formatted as duration string.
+func (p Progress) MarshalJSON() ([]byte, error) {
+	type progress Progress
+	return json.Marshal(struct {
+		progress
+		ETA string `json:"eta"`
+	}{progress(p), p.ETA.String()})
+}
+
+func (p Progress) String() string {
+	return fmt.Sprintf("%v/%v metatiles (done %v, skipped %v, failed %v), %.2f/s, ETA %v",
+		p.Processed, p.Total, p.Done, p.Skipped, p.Failed, p.Rate, p.ETA)
+}
+
+// state is the saved seeding position.
+type state struct {
+	Key   string `json:"key"`
+	Index int    `json:"index"`
+}
+
+// Seeder fetches metatiles for the area and writes them to cache.
+type Seeder struct {
+	opts    Options
+	logger  logger.Logger
+	fetcher *fetch.Fetch
+	cache   cache.ReadWriter
+	// metatiles iterates over metatiles of the area.
+	metatiles *bbox.Metatiles
+
+	mx       sync.Mutex
+	progress Progress
+	resumed  int
+	paused   bool
+	// resume is closed on Resume.
+	resume chan struct{}
+}
+
+// New creates new Seeder.
+func New(opts Options, fetcher *fetch.Fetch, c cache.ReadWriter, logger logger.Logger) *Seeder {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+
+	s := &Seeder{
+		opts:    opts,
+		logger:  logger,
+		fetcher: fetcher,
+		cache:   c,
+	}
+
+	if len(opts.Region) > 0 {
+		s.metatiles = bbox.NewMetatilesFromRegion(opts.Zooms, opts.Region)
+	} else {
+		s.metatiles = bbox.NewMetatiles(opts.Zooms, opts.Top, opts.Bottom)
+	}
+	s.progress.Total = s.metatiles.Count()
+
+	return s
+}
+
+// Progress returns current seeding progress.
+func (s *Seeder) Progress() Progress {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	p := s.progress
+	elapsed := time.Since(p.Started).Seconds()
+	if elapsed > 0 {
+		p.Rate = float64(p.Processed-s.resumed) / elapsed
+	}
+	if p.Rate > 0 {
+		p.ETA = time.Duration(float64(p.Total-p.Processed)/p.Rate) * time.Second
+	}
+
+	return p
+}
+
+// Run runs seeding until all metatiles are processed or ctx is done. Metatiles are processed in
+// batches, position is saved to StateFile after each batch. Fetching and writing are logged with
+// seeder logger.
+func (s *Seeder) Run(ctx context.Context) error {
+	ctx = logger.NewContext(ctx, s.logger)
+	start := s.loadState()
+
+	s.mx.Lock()
+	s.progress.Started = time.Now()
+	s.progress.Processed = start
+	s.resumed = start
+	s.mx.Unlock()
+
+	var limiter <-chan time.Time
+	if s.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / s.opts.Rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	ch := make(chan metatile.Metatile)
+	var batch sync.WaitGroup
+	for w := 0; w < s.opts.Workers; w++ {
+		go func() {
+			for mt := range ch {
+				s.process(ctx, mt)
+				batch.Done()
+			}
+		}()
+	}
+	defer close(ch)
+
+	batchSize := s.opts.Workers * 4
+	i := 0
+	name := s.opts.Source.Name
+	err := s.metatiles.Each(ctx, func(mt metatile.Metatile) bool {
+		mt.Map = name
+		if i < start {
+			i++
+			return true
+		}
+
+		if s.waitResume(ctx) != nil {
+			return false
+		}
+
+		if limiter != nil {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		batch.Add(1)
+		select {
+		case ch <- mt:
+		case <-ctx.Done():
+			batch.Done()
+			return false
+		}
+
+		i++
+		if (i-start)%batchSize == 0 {
+			batch.Wait()
+			if err := s.saveState(i); err != nil {
+				s.logger.Error("seed: save state", "error", err)
+			}
+		}
+
+		return true
+	})
+
+	batch.Wait()
+	if err == nil {
+		// seeding is stopped while the last metatiles are fetching
+		err = ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.opts.StateFile != "" {
+		os.Remove(s.opts.StateFile)
+	}
+
+	return nil
+}
+
+// Pause pauses seeding after metatiles, which are fetching now.
+func (s *Seeder) Pause() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if !s.paused {
+		s.paused = true
+		s.resume = make(chan struct{})
+	}
+}
+
+// Resume resumes paused seeding.
+func (s *Seeder) Resume() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.paused {
+		s.paused = false
+		close(s.resume)
+	}
+}
+
+// Paused returns true if seeding is paused.
+func (s *Seeder) Paused() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.paused
+}
+
+// waitResume blocks while seeding is paused.
+func (s *Seeder) waitResume(ctx context.Context) error {
+	s.mx.Lock()
+	paused, resume := s.paused, s.resume
+	s.mx.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// process fetches metatile and updates progress. Skips metatile if it is cached and not older than
+// opts.MaxAge.
+func (s *Seeder) process(ctx context.Context, mt metatile.Metatile) {
+	found, mtime := s.cache.Check(ctx, tile.Tile{Map: mt.Map, Zoom: mt.Zoom, X: mt.X, Y: mt.Y})
+	if found && (s.opts.MaxAge == 0 || time.Since(mtime) < s.opts.MaxAge) {
+		s.count(&s.progress.Skipped)
+		return
+	}
+
+	for {
+		fl, _ := s.fetcher.Start(ctx, mt, s.opts.Source, s.cache, fetch.PrioritySeed)
+		_, err := fl.Wait(ctx)
+		if err == fetch.ErrQueueFull {
+			select {
+			case <-time.After(queueFullDelay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// fetcher is shut down or seeding is stopped, metatile is not processed
+		if err == fetch.ErrShutdown || err != nil && ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			s.logger.Error("seed: fetch failed", "metatile", mt.Filepath(""), "error", err)
+			s.count(&s.progress.Failed)
+			return
+		}
+
+		s.count(&s.progress.Done)
+		return
+	}
+}
+
+func (s *Seeder) count(counter *int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	*counter++
+	s.progress.Processed++
+}
+
+// loadState returns saved position, or zero if state file is not set, does not exist or contains
+// position for another area.
+func (s *Seeder) loadState() int {
+	if s.opts.StateFile == "" {
+		return 0
+	}
+
+	data, err := ioutil.ReadFile(s.opts.StateFile)
+	if err != nil {
+		return 0
+	}
+
+	var st state
+	if err = json.Unmarshal(data, &st); err != nil || st.Key != s.opts.key() {
+		s.logger.Warn("seed: ignore state file: wrong format or another area", "file", s.opts.StateFile)
+		return 0
+	}
+
+	s.logger.Info("seed: resume", "index", st.Index, "total", s.progress.Total)
+	return st.Index
+}
+
+func (s *Seeder) saveState(index int) error {
+	if s.opts.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(state{Key: s.opts.key(), Index: index})
+	if err != nil {
+		return err
+	}
+
+	tmp := s.opts.StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.opts.StateFile)
+}
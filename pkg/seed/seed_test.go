@@ -0,0 +1,16 @@
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func ExampleProgress_MarshalJSON() {
+	p := Progress{Total: 10, Processed: 4, Done: 3, Skipped: 1, Rate: 2, ETA: 3 * time.Second}
+	data, _ := json.Marshal(p)
+	fmt.Println(string(data))
+
+	// Output:
+	// {"total":10,"processed":4,"done":3,"skipped":1,"failed":0,"rate":2,"started":"0001-01-01T00:00:00Z","eta":"3s"}
+}
@@ -0,0 +1,76 @@
+// Package tilejson generates TileJSON 3.0 documents for configured sources.
+//
+// https://github.com/mapbox/tilejson-spec/tree/master/3.0.0
+package tilejson
+
+import (
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+)
+
+// Version is the version of TileJSON specification.
+const Version = "3.0.0"
+
+// MaxLat is the maximum latitude of Web Mercator projection.
+const MaxLat = 85.0511
+
+// defaultFormat is the tile format of sources with unknown extension.
+const defaultFormat = "png"
+
+// TileJSON is the TileJSON document.
+type TileJSON struct {
+	TileJSON    string   `json:"tilejson"`
+	Name        string   `json:"name"`
+	Tiles       []string `json:"tiles"`
+	Scheme      string   `json:"scheme"`
+	MinZoom     int      `json:"minzoom"`
+	MaxZoom     int      `json:"maxzoom"`
+	Bounds      Bounds   `json:"bounds"`
+	Attribution string   `json:"attribution,omitempty"`
+	Format      string   `json:"format"`
+	// VectorLayers is required for vector tiles. Layers are not known, so list is empty.
+	VectorLayers *[]struct{} `json:"vector_layers,omitempty"`
+}
+
+// Bounds is the area of tiles: left, bottom, right, top in WGS 84.
+type Bounds [4]float64
+
+// WorldBounds is the area of the whole world.
+var WorldBounds = Bounds{-180, -MaxLat, 180, MaxLat}
+
+// New returns TileJSON document for src. Tiles are served from baseURL, e.g.
+// "https://tiles.example.org": https://tiles.example.org/maps/{name}/{z}/{x}/{y}.{format}.
+//
+// Source region does not limit coverage, it only changes zoom levels inside it. So bounds are the
+// whole world, and zoom levels are extended by region zoom levels (see config.Source.ZoomLimits).
+func New(src config.Source, baseURL string) TileJSON {
+	format := Format(src)
+	minZoom, maxZoom := src.ZoomLimits()
+	tj := TileJSON{
+		TileJSON:    Version,
+		Name:        src.Name,
+		Tiles:       []string{strings.TrimSuffix(baseURL, "/") + "/maps/" + src.Name + "/{z}/{x}/{y}." + format},
+		Scheme:      "xyz",
+		MinZoom:     minZoom,
+		MaxZoom:     maxZoom,
+		Bounds:      WorldBounds,
+		Attribution: src.Attribution,
+		Format:      format,
+	}
+
+	if format == "mvt" {
+		tj.VectorLayers = &[]struct{}{}
+	}
+
+	return tj
+}
+
+// Format returns tile format of src (extension without dot), "png" if it is unknown.
+func Format(src config.Source) string {
+	if src.Ext == "" {
+		return defaultFormat
+	}
+
+	return strings.TrimPrefix(src.Ext, ".")
+}
@@ -0,0 +1,37 @@
+package tilejson
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+)
+
+func ExampleNew() {
+	src := config.Source{
+		Name:        "style",
+		Ext:         ".png",
+		Zoom:        config.Zoom{Min: 1, Max: 18},
+		Attribution: "OpenStreetMap",
+	}
+	data, _ := json.Marshal(New(src, "https://tiles.example.org/"))
+	fmt.Println(string(data))
+
+	src.Region = config.Region{
+		File:     "region.yaml",
+		Zoom:     config.Zoom{Min: 3, Max: 19},
+		Polygons: polygon.Region{{{Lat: 55.9, Long: 37.3}, {Lat: 55.9, Long: 37.9}, {Lat: 55.5, Long: 37.9}}},
+	}
+	tj := New(src, "")
+	fmt.Println(tj.MinZoom, tj.MaxZoom, tj.Bounds)
+
+	src.Ext = ".mvt"
+	data, _ = json.Marshal(New(src, "").VectorLayers)
+	fmt.Println(string(data))
+
+	// Output:
+	// {"tilejson":"3.0.0","name":"style","tiles":["https://tiles.example.org/maps/style/{z}/{x}/{y}.png"],"scheme":"xyz","minzoom":1,"maxzoom":18,"bounds":[-180,-85.0511,180,85.0511],"attribution":"OpenStreetMap","format":"png"}
+	// 1 19 [-180 -85.0511 180 85.0511]
+	// []
+}
@@ -25,6 +25,8 @@ func Mimetype(ext string) (string, error) {
 	switch ext {
 	case ".png":
 		return "image/png", nil
+	case ".jpg", ".jpeg":
+		return "image/jpeg", nil
 	case ".json", ".topojson", ".geojson":
 		return "application/json", nil
 	case ".mvt":
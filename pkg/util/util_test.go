@@ -37,7 +37,7 @@ func ExampleDigestString() {
 }
 
 func ExampleMimetype() {
-	exts := []string{".png", ".json", ".topojson", ".geojson", ".mvt", ".unknown"}
+	exts := []string{".png", ".jpg", ".json", ".topojson", ".geojson", ".mvt", ".unknown"}
 
 	for _, ext := range exts {
 		mt, err := Mimetype(ext)
@@ -50,6 +50,7 @@ func ExampleMimetype() {
 
 	// Output:
 	// .png image/png
+	// .jpg image/jpeg
 	// .json application/json
 	// .topojson application/json
 	// .geojson application/json
@@ -0,0 +1,140 @@
+// Package validate contains functions for checking tile data fetched from remote source before
+// writing it to cache.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+)
+
+var (
+	sigPNG  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+	sigJPEG = []byte{0xff, 0xd8, 0xff}
+	sigGzip = []byte{0x1f, 0x8b}
+)
+
+// Format checks if data looks like tile in format given by extension. Extension must be started
+// with dot: `.png`. Unknown extensions are not checked.
+func Format(ext string, data []byte) error {
+	switch ext {
+	case ".png":
+		if !bytes.HasPrefix(data, sigPNG) {
+			return fmt.Errorf("validate/Format: data is not png image")
+		}
+	case ".jpg", ".jpeg":
+		if !bytes.HasPrefix(data, sigJPEG) {
+			return fmt.Errorf("validate/Format: data is not jpeg image")
+		}
+	case ".mvt", ".pbf":
+		if bytes.HasPrefix(data, sigGzip) {
+			return nil
+		}
+		if err := protobuf(data); err != nil {
+			return fmt.Errorf("validate/Format: data is not gzip or protobuf: %v", err)
+		}
+	case ".json", ".topojson", ".geojson":
+		if !json.Valid(data) {
+			return fmt.Errorf("validate/Format: data is not valid json")
+		}
+	}
+
+	return nil
+}
+
+// ContentType checks if media type of ct is one of allowed. Empty allowed list means any type.
+func ContentType(ct string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("validate/ContentType: %q: %v", ct, err)
+	}
+
+	for _, a := range allowed {
+		if mt == a {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("validate/ContentType: unexpected Content-Type %q", ct)
+}
+
+// Size checks if size is between min and max. Zero min or max value disables the check.
+func Size(size, min, max int) error {
+	if min > 0 && size < min {
+		return fmt.Errorf("validate/Size: size %v < %v", size, min)
+	}
+
+	if max > 0 && size > max {
+		return fmt.Errorf("validate/Size: size %v > %v", size, max)
+	}
+
+	return nil
+}
+
+// protobuf walks top-level fields of protobuf message and checks that data is well-formed.
+func protobuf(data []byte) error {
+	for i := 0; i < len(data); {
+		key, n := varint(data[i:])
+		if n == 0 {
+			return fmt.Errorf("invalid field key at %v", i)
+		}
+		i += n
+
+		if key>>3 == 0 {
+			return fmt.Errorf("invalid field number at %v", i)
+		}
+
+		switch key & 0x7 {
+		case 0:
+			_, n = varint(data[i:])
+			if n == 0 {
+				return fmt.Errorf("invalid varint at %v", i)
+			}
+			i += n
+		case 1:
+			if len(data)-i < 8 {
+				return fmt.Errorf("unexpected end of data")
+			}
+			i += 8
+		case 2:
+			// check length before advancing: too large length overflows int
+			l, n := varint(data[i:])
+			if n <= 0 {
+				return fmt.Errorf("invalid length at %v", i)
+			}
+			if l > uint64(len(data)-i-n) {
+				return fmt.Errorf("unexpected end of data")
+			}
+			i += n + int(l)
+		case 5:
+			if len(data)-i < 4 {
+				return fmt.Errorf("unexpected end of data")
+			}
+			i += 4
+		default:
+			return fmt.Errorf("unknown wire type %v at %v", key&0x7, i)
+		}
+	}
+
+	return nil
+}
+
+// varint decodes protobuf varint from the beginning of data. Returns value and number of bytes
+// read, or zero if varint is invalid.
+func varint(data []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		b := data[i]
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+
+	return 0, 0
+}
@@ -0,0 +1,67 @@
+package validate
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	testData := []struct {
+		ext  string
+		data []byte
+		ok   bool
+	}{
+		{".png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), true},
+		{".png", []byte("<html><body>captive portal</body></html>"), false},
+		{".jpg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), true},
+		{".jpeg", []byte("\x89PNG\r\n\x1a\n"), false},
+		{".mvt", []byte("\x1f\x8b\x08\x00"), true},
+		// layer (field 3, length 2) with version (field 15, varint 2)
+		{".mvt", []byte("\x1a\x02\x78\x02"), true},
+		{".mvt", []byte{}, true},
+		{".mvt", []byte(`{"error": "not found"}`), false},
+		{".pbf", []byte("\x1a\x10\x78"), false},
+		// length >= 2^63 must not move position backwards
+		{".mvt", []byte{0x0a, 0xf5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, false},
+		// fixed64 and fixed32 fields without enough data
+		{".mvt", []byte("\x09\x00\x00"), false},
+		{".mvt", []byte("\x0d\x00\x00\x00\x00"), true},
+		{".mvt", []byte("\x0d\x00\x00\x00"), false},
+		{".geojson", []byte(`{"type": "FeatureCollection", "features": []}`), true},
+		{".json", []byte("<html></html>"), false},
+		{".unknown", []byte("anything"), true},
+	}
+
+	for _, tt := range testData {
+		err := Format(tt.ext, tt.data)
+		if (err == nil) != tt.ok {
+			t.Errorf("Format(%v, %q): expected ok=%v, got error %v", tt.ext, tt.data, tt.ok, err)
+		}
+	}
+}
+
+func ExampleContentType() {
+	allowed := []string{"image/png"}
+	cts := []string{"image/png", "image/png; charset=binary", "text/html; charset=utf-8", ""}
+
+	for _, ct := range cts {
+		fmt.Printf("%q: %v\n", ct, ContentType(ct, allowed))
+	}
+
+	// Output:
+	// "image/png": <nil>
+	// "image/png; charset=binary": <nil>
+	// "text/html; charset=utf-8": validate/ContentType: unexpected Content-Type "text/html; charset=utf-8"
+	// "": validate/ContentType: "": mime: no media type
+}
+
+func ExampleSize() {
+	fmt.Println(Size(10, 0, 0))
+	fmt.Println(Size(10, 100, 0))
+	fmt.Println(Size(1000, 100, 500))
+
+	// Output:
+	// <nil>
+	// validate/Size: size 10 < 100
+	// validate/Size: size 1000 > 500
+}
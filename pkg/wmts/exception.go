@@ -0,0 +1,48 @@
+package wmts
+
+import "encoding/xml"
+
+// Exception codes.
+const (
+	MissingParameterValue = "MissingParameterValue"
+	InvalidParameterValue = "InvalidParameterValue"
+	OperationNotSupported = "OperationNotSupported"
+	TileOutOfRange        = "TileOutOfRange"
+)
+
+// Exception is the error of WMTS request. Locator is the name of wrong request parameter.
+type Exception struct {
+	Code    string
+	Locator string
+	Text    string
+}
+
+func (e Exception) Error() string {
+	if e.Locator == "" {
+		return e.Code + ": " + e.Text
+	}
+
+	return e.Code + ": " + e.Locator + ": " + e.Text
+}
+
+type exceptionReport struct {
+	XMLName   xml.Name    `xml:"ows:ExceptionReport"`
+	XmlnsOWS  string      `xml:"xmlns:ows,attr"`
+	Version   string      `xml:"version,attr"`
+	Exception []exception `xml:"ows:Exception"`
+}
+
+type exception struct {
+	Code    string `xml:"exceptionCode,attr"`
+	Locator string `xml:"locator,attr,omitempty"`
+	Text    string `xml:"ows:ExceptionText"`
+}
+
+// MarshalXML implements xml.Marshaler interface: exception is encoded as OWS exception report.
+func (e Exception) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return enc.Encode(exceptionReport{
+		XmlnsOWS:  "http://www.opengis.net/ows/1.1",
+		Version:   "1.1.0",
+		Exception: []exception{{Code: e.Code, Locator: e.Locator, Text: e.Text}},
+	})
+}
@@ -0,0 +1,182 @@
+package wmts
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/tile"
+	"github.com/tierpod/metatiles-cacher/pkg/tilejson"
+	"github.com/tierpod/metatiles-cacher/pkg/util"
+)
+
+// WMTS operations.
+const (
+	GetCapabilities = "GetCapabilities"
+	GetTile         = "GetTile"
+)
+
+// capabilitiesFile is the path of capabilities document in RESTful encoding.
+const capabilitiesFile = "WMTSCapabilities.xml"
+
+// TileRequest contains parameters of GetTile request.
+type TileRequest struct {
+	Layer         string
+	Style         string
+	TileMatrixSet string
+	TileMatrix    int
+	TileRow       int
+	TileCol       int
+	// Format is the mimetype of tile.
+	Format string
+}
+
+// ParseKVP parses parameters of KVP request, names of parameters are case-insensitive. Returns
+// operation and, for GetTile operation, tile request. Returns Exception if request is not valid.
+func ParseKVP(query url.Values) (string, TileRequest, error) {
+	params := make(map[string]string)
+	for k, v := range query {
+		params[strings.ToUpper(k)] = v[0]
+	}
+
+	var tr TileRequest
+	if params["SERVICE"] == "" {
+		return "", tr, Exception{Code: MissingParameterValue, Locator: "Service", Text: "parameter is not set"}
+	}
+	if params["SERVICE"] != "WMTS" {
+		return "", tr, Exception{Code: InvalidParameterValue, Locator: "Service", Text: "service is not WMTS"}
+	}
+
+	switch params["REQUEST"] {
+	case GetCapabilities:
+		return GetCapabilities, tr, nil
+	case GetTile:
+	case "":
+		return "", tr, Exception{Code: MissingParameterValue, Locator: "Request", Text: "parameter is not set"}
+	default:
+		return "", tr, Exception{Code: OperationNotSupported, Locator: "Request", Text: "unknown operation " + params["REQUEST"]}
+	}
+
+	tr.Style = params["STYLE"]
+	tr.Format = params["FORMAT"]
+
+	for _, name := range []string{"Layer", "TileMatrixSet"} {
+		if params[strings.ToUpper(name)] == "" {
+			return "", tr, Exception{Code: MissingParameterValue, Locator: name, Text: "parameter is not set"}
+		}
+	}
+	tr.Layer = params["LAYER"]
+	tr.TileMatrixSet = params["TILEMATRIXSET"]
+
+	for _, p := range []struct {
+		name string
+		v    *int
+	}{{"TileMatrix", &tr.TileMatrix}, {"TileRow", &tr.TileRow}, {"TileCol", &tr.TileCol}} {
+		if err := parseInt(p.name, params[strings.ToUpper(p.name)], p.v); err != nil {
+			return "", tr, err
+		}
+	}
+
+	return GetTile, tr, nil
+}
+
+// ParseREST parses path of RESTful request relative to service URL:
+// "1.0.0/WMTSCapabilities.xml" or "1.0.0/{Layer}/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.{ext}".
+// Returns operation and, for GetTile operation, tile request. Returns Exception if request is not
+// valid.
+func ParseREST(p string) (string, TileRequest, error) {
+	var tr TileRequest
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if parts[0] != Version {
+		return "", tr, Exception{Code: InvalidParameterValue, Locator: "Version", Text: "unsupported version " + parts[0]}
+	}
+
+	if len(parts) == 2 && parts[1] == capabilitiesFile {
+		return GetCapabilities, tr, nil
+	}
+
+	if len(parts) != 7 {
+		return "", tr, Exception{Code: OperationNotSupported, Text: "unknown resource " + p}
+	}
+
+	ext := path.Ext(parts[6])
+	mimetype, err := util.Mimetype(ext)
+	if err != nil {
+		return "", tr, Exception{Code: InvalidParameterValue, Locator: "Format", Text: err.Error()}
+	}
+
+	tr = TileRequest{
+		Layer:         parts[1],
+		Style:         parts[2],
+		TileMatrixSet: parts[3],
+		Format:        mimetype,
+	}
+
+	values := []string{parts[4], parts[5], strings.TrimSuffix(parts[6], ext)}
+	for i, p := range []struct {
+		name string
+		v    *int
+	}{{"TileMatrix", &tr.TileMatrix}, {"TileRow", &tr.TileRow}, {"TileCol", &tr.TileCol}} {
+		if err := parseInt(p.name, values[i], p.v); err != nil {
+			return "", tr, err
+		}
+	}
+
+	return GetTile, tr, nil
+}
+
+func parseInt(name, s string, v *int) error {
+	if s == "" {
+		return Exception{Code: MissingParameterValue, Locator: name, Text: "parameter is not set"}
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return Exception{Code: InvalidParameterValue, Locator: name, Text: "not a non-negative integer: " + s}
+	}
+
+	*v = n
+	return nil
+}
+
+// Tile checks tile request against layer of src and returns XYZ tile with src extension. Returns
+// Exception if style, tile matrix set or format are not supported by the layer, or tile is out of
+// layer tile matrix limits. Empty style and format are allowed.
+func (tr TileRequest) Tile(src config.Source) (tile.Tile, error) {
+	layer := NewLayer(src)
+
+	if tr.Style != "" && tr.Style != Style {
+		return tile.Tile{}, Exception{Code: InvalidParameterValue, Locator: "Style", Text: "unknown style " + tr.Style}
+	}
+
+	if tr.TileMatrixSet != TileMatrixSet {
+		return tile.Tile{}, Exception{Code: InvalidParameterValue, Locator: "TileMatrixSet", Text: "unknown tile matrix set " + tr.TileMatrixSet}
+	}
+
+	if tr.Format != "" && tr.Format != layer.Format {
+		return tile.Tile{}, Exception{Code: InvalidParameterValue, Locator: "Format", Text: "unsupported format " + tr.Format}
+	}
+
+	limits, found := layer.Limits(tr.TileMatrix)
+	if !found {
+		return tile.Tile{}, Exception{Code: TileOutOfRange, Locator: "TileMatrix", Text: "tile matrix is out of layer zoom levels"}
+	}
+
+	if tr.TileRow < limits.MinTileRow || tr.TileRow > limits.MaxTileRow {
+		return tile.Tile{}, Exception{Code: TileOutOfRange, Locator: "TileRow", Text: "tile row is out of layer limits"}
+	}
+
+	if tr.TileCol < limits.MinTileCol || tr.TileCol > limits.MaxTileCol {
+		return tile.Tile{}, Exception{Code: TileOutOfRange, Locator: "TileCol", Text: "tile column is out of layer limits"}
+	}
+
+	return tile.Tile{
+		Map:  src.Name,
+		Zoom: tr.TileMatrix,
+		X:    tr.TileCol,
+		Y:    tr.TileRow,
+		Ext:  "." + tilejson.Format(src),
+	}, nil
+}
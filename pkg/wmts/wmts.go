@@ -0,0 +1,242 @@
+// Package wmts generates OGC WMTS 1.0.0 capabilities documents and exception reports for configured
+// sources. Sources are served as layers in GoogleMapsCompatible tile matrix set (Web Mercator,
+// tiles 256x256, top left origin), so tile matrix is zoom level, tile column is x and tile row is y
+// of XYZ tile.
+//
+// http://www.opengeospatial.org/standards/wmts
+package wmts
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/tilejson"
+	"github.com/tierpod/metatiles-cacher/pkg/util"
+)
+
+// WMTS service constants.
+const (
+	Version       = "1.0.0"
+	TileMatrixSet = "GoogleMapsCompatible"
+	Style         = "default"
+)
+
+const (
+	crs          = "urn:ogc:def:crs:EPSG::3857"
+	wellKnownSet = "urn:ogc:def:wkss:OGC:1.0:GoogleMapsCompatible"
+	// originShift is the half of Web Mercator extent in meters.
+	originShift = 20037508.3427892
+	// scaleDenominator is the scale denominator of zoom level 0.
+	scaleDenominator = 559082264.0287178
+	tileSize         = 256
+)
+
+// Capabilities is the GetCapabilities response document.
+type Capabilities struct {
+	XMLName            xml.Name           `xml:"Capabilities"`
+	Xmlns              string             `xml:"xmlns,attr"`
+	XmlnsOWS           string             `xml:"xmlns:ows,attr"`
+	XmlnsXlink         string             `xml:"xmlns:xlink,attr"`
+	Version            string             `xml:"version,attr"`
+	Service            serviceID          `xml:"ows:ServiceIdentification"`
+	Operations         []operation        `xml:"ows:OperationsMetadata>ows:Operation"`
+	Layers             []Layer            `xml:"Contents>Layer"`
+	TileMatrixSet      tileMatrixSet      `xml:"Contents>TileMatrixSet"`
+	ServiceMetadataURL serviceMetadataURL `xml:"ServiceMetadataURL"`
+}
+
+type serviceID struct {
+	Title       string `xml:"ows:Title"`
+	ServiceType string `xml:"ows:ServiceType"`
+	Version     string `xml:"ows:ServiceTypeVersion"`
+}
+
+type operation struct {
+	Name string    `xml:"name,attr"`
+	Get  []httpGet `xml:"ows:DCP>ows:HTTP>ows:Get"`
+}
+
+// httpGet is the URL of operation with allowed encoding: KVP or RESTful.
+type httpGet struct {
+	Href     string `xml:"xlink:href,attr"`
+	Encoding string `xml:"ows:Constraint>ows:AllowedValues>ows:Value"`
+}
+
+// Layer is the WMTS layer of source.
+type Layer struct {
+	Title       string      `xml:"ows:Title"`
+	BoundingBox boundingBox `xml:"ows:WGS84BoundingBox"`
+	Identifier  string      `xml:"ows:Identifier"`
+	Style       style       `xml:"Style"`
+	Format      string      `xml:"Format"`
+	Link        matrixLink  `xml:"TileMatrixSetLink"`
+	ResourceURL resourceURL `xml:"ResourceURL"`
+}
+
+type boundingBox struct {
+	CRS   string `xml:"crs,attr,omitempty"`
+	Lower string `xml:"ows:LowerCorner"`
+	Upper string `xml:"ows:UpperCorner"`
+}
+
+type style struct {
+	IsDefault  bool   `xml:"isDefault,attr"`
+	Identifier string `xml:"ows:Identifier"`
+}
+
+type matrixLink struct {
+	TileMatrixSet string       `xml:"TileMatrixSet"`
+	Limits        []TileLimits `xml:"TileMatrixSetLimits>TileMatrixLimits"`
+}
+
+// TileLimits contains tile rows and columns of layer on tile matrix (zoom level).
+type TileLimits struct {
+	TileMatrix int `xml:"TileMatrix"`
+	MinTileRow int `xml:"MinTileRow"`
+	MaxTileRow int `xml:"MaxTileRow"`
+	MinTileCol int `xml:"MinTileCol"`
+	MaxTileCol int `xml:"MaxTileCol"`
+}
+
+type resourceURL struct {
+	Format       string `xml:"format,attr"`
+	ResourceType string `xml:"resourceType,attr"`
+	Template     string `xml:"template,attr"`
+}
+
+type tileMatrixSet struct {
+	Identifier   string       `xml:"ows:Identifier"`
+	BoundingBox  boundingBox  `xml:"ows:BoundingBox"`
+	SupportedCRS string       `xml:"ows:SupportedCRS"`
+	WellKnown    string       `xml:"WellKnownScaleSet"`
+	Matrices     []tileMatrix `xml:"TileMatrix"`
+}
+
+type tileMatrix struct {
+	Identifier       int    `xml:"ows:Identifier"`
+	ScaleDenominator string `xml:"ScaleDenominator"`
+	TopLeftCorner    string `xml:"TopLeftCorner"`
+	TileWidth        int    `xml:"TileWidth"`
+	TileHeight       int    `xml:"TileHeight"`
+	MatrixWidth      int    `xml:"MatrixWidth"`
+	MatrixHeight     int    `xml:"MatrixHeight"`
+}
+
+type serviceMetadataURL struct {
+	Href string `xml:"xlink:href,attr"`
+}
+
+// NewCapabilities returns capabilities document with layers of sources. Service is served from
+// baseURL, e.g. "https://tiles.example.org": KVP requests to https://tiles.example.org/wmts?,
+// RESTful requests to https://tiles.example.org/wmts/1.0.0/.
+//
+// Tile matrix set contains zoom levels from 0 to the maximum zoom level of sources. Tile matrix
+// limits of each layer contain zoom levels of source, extended by region zoom levels (see
+// config.Source.ZoomLimits), and all tiles of zoom level.
+func NewCapabilities(sources []config.Source, baseURL string) Capabilities {
+	base := strings.TrimSuffix(baseURL, "/") + "/wmts"
+	get := []httpGet{{Href: base + "?", Encoding: "KVP"}, {Href: base + "/" + Version + "/", Encoding: "RESTful"}}
+
+	c := Capabilities{
+		Xmlns:      "http://www.opengis.net/wmts/1.0",
+		XmlnsOWS:   "http://www.opengis.net/ows/1.1",
+		XmlnsXlink: "http://www.w3.org/1999/xlink",
+		Version:    Version,
+		Service: serviceID{
+			Title:       "metatiles-cacher",
+			ServiceType: "OGC WMTS",
+			Version:     Version,
+		},
+		Operations: []operation{
+			{Name: "GetCapabilities", Get: get},
+			{Name: "GetTile", Get: get},
+		},
+		ServiceMetadataURL: serviceMetadataURL{Href: base + "/" + Version + "/WMTSCapabilities.xml"},
+	}
+
+	maxZoom := 0
+	for _, src := range sources {
+		layer := NewLayer(src)
+		layer.ResourceURL.Template = fmt.Sprintf("%v/%v/%v/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.%v",
+			base, Version, src.Name, tilejson.Format(src))
+		c.Layers = append(c.Layers, layer)
+
+		if _, max := src.ZoomLimits(); max > maxZoom {
+			maxZoom = max
+		}
+	}
+
+	c.TileMatrixSet = tileMatrixSet{
+		Identifier: TileMatrixSet,
+		BoundingBox: boundingBox{
+			CRS:   crs,
+			Lower: fmt.Sprintf("%.7f %.7f", -originShift, -originShift),
+			Upper: fmt.Sprintf("%.7f %.7f", originShift, originShift),
+		},
+		SupportedCRS: crs,
+		WellKnown:    wellKnownSet,
+	}
+	for z := 0; z <= maxZoom; z++ {
+		n := 1 << uint(z)
+		c.TileMatrixSet.Matrices = append(c.TileMatrixSet.Matrices, tileMatrix{
+			Identifier:       z,
+			ScaleDenominator: fmt.Sprintf("%.10g", scaleDenominator/float64(n)),
+			TopLeftCorner:    fmt.Sprintf("%.7f %.7f", -originShift, originShift),
+			TileWidth:        tileSize,
+			TileHeight:       tileSize,
+			MatrixWidth:      n,
+			MatrixHeight:     n,
+		})
+	}
+
+	return c
+}
+
+// NewLayer returns layer of src without resource URL. Layer bounds are the whole world.
+func NewLayer(src config.Source) Layer {
+	b := tilejson.WorldBounds
+	mimetype, _ := util.Mimetype("." + tilejson.Format(src))
+
+	layer := Layer{
+		Title: src.Name,
+		BoundingBox: boundingBox{
+			Lower: fmt.Sprintf("%v %v", b[0], b[1]),
+			Upper: fmt.Sprintf("%v %v", b[2], b[3]),
+		},
+		Identifier: src.Name,
+		Style:      style{IsDefault: true, Identifier: Style},
+		Format:     mimetype,
+		Link:       matrixLink{TileMatrixSet: TileMatrixSet},
+		ResourceURL: resourceURL{
+			Format:       mimetype,
+			ResourceType: "tile",
+		},
+	}
+
+	// region does not limit coverage, so layer contains all tiles of zoom level
+	minZoom, maxZoom := src.ZoomLimits()
+	for z := minZoom; z <= maxZoom; z++ {
+		max := 1<<uint(z) - 1
+		layer.Link.Limits = append(layer.Link.Limits, TileLimits{
+			TileMatrix: z,
+			MaxTileRow: max,
+			MaxTileCol: max,
+		})
+	}
+
+	return layer
+}
+
+// Limits returns tile limits of layer on zoom level. Returns false if layer does not contain this
+// zoom level.
+func (l Layer) Limits(zoom int) (TileLimits, bool) {
+	for _, lim := range l.Link.Limits {
+		if lim.TileMatrix == zoom {
+			return lim, true
+		}
+	}
+
+	return TileLimits{}, false
+}
@@ -0,0 +1,159 @@
+package wmts
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tierpod/metatiles-cacher/pkg/config"
+	"github.com/tierpod/metatiles-cacher/pkg/polygon"
+)
+
+func ExampleNewLayer() {
+	src := config.Source{
+		Name: "style",
+		Ext:  ".png",
+		Zoom: config.Zoom{Min: 1, Max: 10},
+		Region: config.Region{
+			File:     "region.yaml",
+			Zoom:     config.Zoom{Min: 1, Max: 12},
+			Polygons: polygon.Region{{{Lat: 55.9, Long: 37.3}, {Lat: 55.9, Long: 37.9}, {Lat: 55.5, Long: 37.9}}},
+		},
+	}
+
+	layer := NewLayer(src)
+	fmt.Println(layer.Format, layer.BoundingBox.Lower, layer.BoundingBox.Upper)
+	for _, z := range []int{0, 1, 12, 13} {
+		fmt.Println(layer.Limits(z))
+	}
+
+	// Output:
+	// image/png -180 -85.0511 180 85.0511
+	// {0 0 0 0 0} false
+	// {1 0 1 0 1} true
+	// {12 0 4095 0 4095} true
+	// {0 0 0 0 0} false
+}
+
+func TestNewCapabilities(t *testing.T) {
+	sources := []config.Source{
+		{Name: "style1", Ext: ".png", Zoom: config.Zoom{Min: 1, Max: 3},
+			Region: config.Region{File: "region.yaml", Zoom: config.Zoom{Min: 1, Max: 7}}},
+		{Name: "style2", Ext: ".jpg", Zoom: config.Zoom{Min: 0, Max: 5}},
+	}
+
+	c := NewCapabilities(sources, "https://tiles.example.org/")
+	if len(c.Layers) != 2 || len(c.TileMatrixSet.Matrices) != 8 {
+		t.Fatalf("expected 2 layers and 8 tile matrices, got %v and %v", len(c.Layers), len(c.TileMatrixSet.Matrices))
+	}
+
+	expected := "https://tiles.example.org/wmts/1.0.0/style2/{Style}/{TileMatrixSet}/{TileMatrix}/{TileRow}/{TileCol}.jpg"
+	if tmpl := c.Layers[1].ResourceURL.Template; tmpl != expected {
+		t.Errorf("expected template %v, got %v", expected, tmpl)
+	}
+
+	data, err := xml.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<ows:Operation name="GetTile">`,
+		`<ows:Get xlink:href="https://tiles.example.org/wmts?"><ows:Constraint><ows:AllowedValues><ows:Value>KVP</ows:Value>`,
+		`<TileMatrix><ows:Identifier>5</ows:Identifier><ScaleDenominator>17471320.75</ScaleDenominator>`,
+		`<TileMatrixLimits><TileMatrix>3</TileMatrix><MinTileRow>0</MinTileRow><MaxTileRow>7</MaxTileRow>`,
+		`<TileMatrixLimits><TileMatrix>7</TileMatrix><MinTileRow>0</MinTileRow><MaxTileRow>127</MaxTileRow>`,
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("capabilities do not contain %v", s)
+		}
+	}
+}
+
+func TestTileRequest(t *testing.T) {
+	src := config.Source{Name: "style", Ext: ".png", Zoom: config.Zoom{Min: 1, Max: 10}}
+
+	testData := []struct {
+		kvp  string
+		rest string
+		tile string
+		err  string
+	}{
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&STYLE=default&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=3&TILEROW=2&TILECOL=5&FORMAT=image/png",
+			"1.0.0/style/default/GoogleMapsCompatible/3/2/5.png",
+			"style/3/5/2.png", "",
+		},
+		{
+			"service=WMTS&request=GetTile&layer=style&tilematrixset=GoogleMapsCompatible&tilematrix=3&tilerow=2&tilecol=5",
+			"",
+			"style/3/5/2.png", "",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=0&TILEROW=0&TILECOL=0",
+			"1.0.0/style/default/GoogleMapsCompatible/0/0/0.png",
+			"", "TileOutOfRange: TileMatrix: tile matrix is out of layer zoom levels",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=1&TILEROW=2&TILECOL=0",
+			"1.0.0/style/default/GoogleMapsCompatible/1/2/0.png",
+			"", "TileOutOfRange: TileRow: tile row is out of layer limits",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&TILEMATRIXSET=EPSG:4326&TILEMATRIX=1&TILEROW=0&TILECOL=0",
+			"1.0.0/style/default/EPSG:4326/1/0/0.png",
+			"", "InvalidParameterValue: TileMatrixSet: unknown tile matrix set EPSG:4326",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=1&TILEROW=0&TILECOL=0&FORMAT=image/jpeg",
+			"1.0.0/style/default/GoogleMapsCompatible/1/0/0.jpg",
+			"", "InvalidParameterValue: Format: unsupported format image/jpeg",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetTile&LAYER=style&TILEMATRIXSET=GoogleMapsCompatible&TILEMATRIX=1&TILECOL=0",
+			"",
+			"", "MissingParameterValue: TileRow: parameter is not set",
+		},
+		{
+			"SERVICE=WMTS&REQUEST=GetFeatureInfo",
+			"1.0.0/style/default/GoogleMapsCompatible/1/0/0/1.png",
+			"", "OperationNotSupported: ",
+		},
+	}
+
+	for _, tt := range testData {
+		query, _ := url.ParseQuery(tt.kvp)
+		check := func(name string, op string, tr TileRequest, err error) {
+			if err == nil && op == GetTile {
+				tl, terr := tr.Tile(src)
+				if terr == nil {
+					if s := tl.Filepath(""); s != tt.tile {
+						t.Errorf("%v: expected tile %v, got %v", name, tt.tile, s)
+					}
+					return
+				}
+				err = terr
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) || tt.err == "" {
+				t.Errorf("%v: expected error %q, got %v", name, tt.err, err)
+			}
+		}
+
+		op, tr, err := ParseKVP(query)
+		check(tt.kvp, op, tr, err)
+		if tt.rest != "" {
+			op, tr, err = ParseREST(tt.rest)
+			check(tt.rest, op, tr, err)
+		}
+	}
+}
+
+func ExampleException_MarshalXML() {
+	data, _ := xml.Marshal(Exception{Code: TileOutOfRange, Locator: "TileMatrix", Text: "tile matrix is out of layer zoom levels"})
+	fmt.Println(string(data))
+
+	// Output:
+	// <ows:ExceptionReport xmlns:ows="http://www.opengis.net/ows/1.1" version="1.1.0"><ows:Exception exceptionCode="TileOutOfRange" locator="TileMatrix"><ows:ExceptionText>tile matrix is out of layer zoom levels</ows:ExceptionText></ows:Exception></ows:ExceptionReport>
+}